@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/boltdb/bolt"
+	sdk "github.com/imshuai/alistsdk-go"
+)
+
+// AlistClient 在alistsdk的基础上保存登录token，用于调用sdk没有提供的接口
+//
+// 使用用户名和密码登录时，token过期或失效后会自动重新登录并重试请求
+type AlistClient struct {
+	*sdk.Client
+	endpoint Endpoint
+	auth     *alistAuth
+	token    string // Client使用的token
+	timeout  int
+	http     *http.Client
+	mu       sync.Mutex
+}
+
+// alistAuth 同一服务器的客户端共享的登录状态，token失效时只需重新登录一次
+type alistAuth struct {
+	sync.Mutex
+	token string
+}
+
+// alistError alist接口返回的错误
+type alistError struct {
+	Code    int
+	Message string
+}
+
+func (e *alistError) Error() string {
+	return e.Message
+}
+
+// isAuthError 判断是否为token过期或失效导致的错误，sdk只返回错误信息，只能按信息判断
+func isAuthError(err error) bool {
+	var ae *alistError
+	if errors.As(err, &ae) {
+		return ae.Code == http.StatusUnauthorized
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"token is", "login please", "unauthorized"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// alistResp alist接口的通用返回格式
+type alistResp struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// newAlistClient 初始化ALIST Client并登录，没有配置token和用户名时以游客身份访问
+func newAlistClient(e Endpoint) (*AlistClient, error) {
+	c := &AlistClient{
+		endpoint: e,
+		auth:     &alistAuth{token: e.Token},
+		timeout:  config.Timeout,
+		http:     newHTTPClient(e, config.Timeout),
+	}
+	if c.guest() {
+		// 游客无法登录，请求时不携带token
+		logger.Infof("[MAIN]: %s access as guest", e.BaseURL)
+		return c, nil
+	}
+	if e.Token == "" {
+		// 优先使用缓存的token，避免每次运行都重新登录
+		if token := getCachedToken(e); token != "" {
+			logger.Debugf("[MAIN]: %s use cached token", e.BaseURL)
+			addSecret(token)
+			c.auth.token = token
+		} else {
+			token, err := c.login()
+			if err != nil {
+				return nil, err
+			}
+			c.auth.token = token
+		}
+	}
+	//登录，缓存的token失效时重新登录
+	var u *sdk.User
+	err := c.retry(func(client *sdk.Client, _ string) error {
+		var err error
+		u, err = client.Login()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("[MAIN]: %s login success, username: %s", e.BaseURL, u.Username)
+	return c, nil
+}
+
+// guest 是否以游客身份访问
+func (c *AlistClient) guest() bool {
+	return c.endpoint.Token == "" && c.endpoint.Username == ""
+}
+
+// WithTimeout 返回使用相同token但超时时间不同的客户端，不会重新登录
+func (c *AlistClient) WithTimeout(timeout int) *AlistClient {
+	if timeout <= 0 || timeout == c.timeout {
+		return c
+	}
+	return &AlistClient{
+		endpoint: c.endpoint,
+		auth:     c.auth,
+		timeout:  timeout,
+		http:     newHTTPClient(c.endpoint, timeout),
+	}
+}
+
+// current 返回使用最新token的sdk客户端，token变化后重新创建
+func (c *AlistClient) current() (*sdk.Client, string) {
+	c.auth.Lock()
+	token := c.auth.token
+	c.auth.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Client == nil || c.token != token {
+		c.Client = sdk.NewClientWithToken(c.endpoint.BaseURL, token, c.endpoint.InscureTLSVerify, c.timeout)
+		c.token = token
+	}
+	return c.Client, token
+}
+
+// retry 执行请求，token过期或失效时重新登录并重试一次；配置了token或游客访问时无法重新登录，直接返回错误
+func (c *AlistClient) retry(fn func(client *sdk.Client, token string) error) error {
+	client, token := c.current()
+	err := fn(client, token)
+	if err == nil || c.endpoint.Token != "" || c.guest() || !isAuthError(err) {
+		return err
+	}
+	if err := c.relogin(token, err); err != nil {
+		return err
+	}
+	client, token = c.current()
+	return fn(client, token)
+}
+
+// relogin 重新登录，expired为失效的token，其他线程已经重新登录时不再登录
+func (c *AlistClient) relogin(expired string, cause error) error {
+	c.auth.Lock()
+	defer c.auth.Unlock()
+	if c.auth.token != expired {
+		return nil
+	}
+	logger.Infof("[MAIN]: %s token is no longer valid (%s), login again", c.endpoint.BaseURL, cause.Error())
+	token, err := c.login()
+	if err != nil {
+		return fmt.Errorf("login again error: %s", err.Error())
+	}
+	c.auth.token = token
+	return nil
+}
+
+// login 使用用户名和密码登录，并缓存获取的token
+func (c *AlistClient) login() (string, error) {
+	var data struct {
+		Token string `json:"token"`
+	}
+	err := c.request("/api/auth/login", map[string]string{"username": c.endpoint.Username, "password": c.endpoint.Password}, "", &data)
+	if err != nil {
+		return "", err
+	}
+	addSecret(data.Token)
+	saveCachedToken(c.endpoint, data.Token)
+	return data.Token, nil
+}
+
+// List 列出目录，token失效时重新登录并重试
+func (c *AlistClient) List(path, password string, pageNum, pageSize int, refresh bool) ([]sdk.File, error) {
+	files, _, err := c.ListWithHashes(path, password, pageNum, pageSize, refresh)
+	return files, err
+}
+
+// ListWithHashes 列出目录，同时返回文件名对应的hash信息，键为小写的算法名称，存储没有提供hash时没有对应的项
+//
+// sdk返回的文件不包含hash信息，且没有token时拒绝请求，因此直接调用fs/list接口
+func (c *AlistClient) ListWithHashes(path, password string, pageNum, pageSize int, refresh bool) ([]sdk.File, map[string]map[string]string, error) {
+	var data struct {
+		Content []struct {
+			sdk.File
+			HashInfo map[string]string `json:"hash_info"`
+		} `json:"content"`
+	}
+	body := map[string]interface{}{"path": path, "password": password, "page": pageNum, "per_page": pageSize, "refresh": refresh}
+	if err := c.post("/api/fs/list", body, &data); err != nil {
+		return nil, nil, err
+	}
+	files := make([]sdk.File, 0, len(data.Content))
+	hashes := make(map[string]map[string]string)
+	for _, f := range data.Content {
+		files = append(files, f.File)
+		if h := normalizeHashes(f.HashInfo); len(h) > 0 {
+			hashes[f.Name] = h
+		}
+	}
+	return files, hashes, nil
+}
+
+// post 调用alist接口，data不为空时解析返回的data字段，token失效时重新登录并重试
+func (c *AlistClient) post(api string, body interface{}, data interface{}) error {
+	return c.retry(func(_ *sdk.Client, token string) error {
+		return c.request(api, body, token, data)
+	})
+}
+
+// request 使用指定的token调用alist接口
+func (c *AlistClient) request(api string, body interface{}, token string, data interface{}) error {
+	byts, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.endpoint.BaseURL, "/")+api, bytes.NewReader(byts))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	byts, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	r := &alistResp{}
+	if err := json.Unmarshal(byts, r); err != nil {
+		return fmt.Errorf("unmarshal response of %s error: %s", api, err.Error())
+	}
+	if r.Code != 200 {
+		return &alistError{Code: r.Code, Message: r.Message}
+	}
+	if data == nil || len(r.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Data, data)
+}
+
+// GetHashInfo 通过fs/get接口获取文件的hash信息，返回的键为小写的算法名称，如md5、sha1、sha256
+//
+// 并不是所有的存储都提供hash信息，没有时返回空map
+func (c *AlistClient) GetHashInfo(remotePath string) (map[string]string, error) {
+	var data struct {
+		HashInfo map[string]string `json:"hash_info"`
+	}
+	if err := c.post("/api/fs/get", map[string]string{"path": remotePath}, &data); err != nil {
+		return nil, err
+	}
+	return normalizeHashes(data.HashInfo), nil
+}
+
+// normalizeHashes 将算法名称和hash值转换为小写，并去掉空值
+func normalizeHashes(info map[string]string) map[string]string {
+	hashes := make(map[string]string, len(info))
+	for k, v := range info {
+		if v != "" {
+			hashes[strings.ToLower(k)] = strings.ToLower(v)
+		}
+	}
+	return hashes
+}
+
+// tokenCacheKey 缓存token的键，同一服务器的不同用户分别缓存
+func tokenCacheKey(e Endpoint) []byte {
+	return []byte(strings.TrimRight(e.BaseURL, "/") + "|" + e.Username)
+}
+
+// getCachedToken 获取上次登录缓存的token，没有缓存或数据库未打开时返回空
+func getCachedToken(e Endpoint) string {
+	if db == nil || e.Username == "" {
+		return ""
+	}
+	var token string
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("token"))
+		if b == nil {
+			return nil
+		}
+		token = string(b.Get(tokenCacheKey(e)))
+		return nil
+	})
+	return token
+}
+
+// saveCachedToken 缓存登录获取的token，下次运行时直接使用
+func saveCachedToken(e Endpoint, token string) {
+	if db == nil || e.Username == "" || token == "" {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("token"))
+		if err != nil {
+			return err
+		}
+		return b.Put(tokenCacheKey(e), []byte(token))
+	})
+	if err != nil {
+		logger.Warnf("[MAIN]: save token of %s failed: %s", e.BaseURL, err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestListWithHashesAvoidsGet(t *testing.T) {
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/fs/list":
+			content := []map[string]interface{}{
+				{"name": "A.srt", "size": 10, "hash_info": map[string]string{"SHA1": "ABC", "md5": ""}},
+				{"name": "B.srt", "size": 20, "hash_info": nil},
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "message": "success", "data": map[string]interface{}{"content": content, "total": 2}})
+		case "/api/fs/get":
+			atomic.AddInt32(&gets, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "message": "success", "data": map[string]interface{}{"hash_info": map[string]string{"md5": "DEF"}}})
+		}
+	}))
+	defer srv.Close()
+	e := Endpoint{BaseURL: srv.URL, Token: "token"}
+	client := &AlistClient{endpoint: e, auth: &alistAuth{token: "token"}, timeout: 5, http: newHTTPClient(e, 5)}
+
+	files, hashInfo, err := client.ListWithHashes("/movies", "", 1, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].Name != "A.srt" || files[1].Size != 20 {
+		t.Fatalf("ListWithHashes() files = %+v", files)
+	}
+	if want := map[string]map[string]string{"A.srt": {"sha1": "abc"}}; !reflect.DeepEqual(hashInfo, want) {
+		t.Errorf("ListWithHashes() hashes = %v, want %v", hashInfo, want)
+	}
+
+	m := &Mission{client: client}
+	if got := m.hashInfo(0, "/movies/A.srt", hashInfo["A.srt"]); got["sha1"] != "abc" || atomic.LoadInt32(&gets) != 0 {
+		t.Errorf("hashInfo() = %v with %d fs/get calls, want listed hashes without fs/get", got, gets)
+	}
+	if got := m.hashInfo(0, "/movies/B.srt", hashInfo["B.srt"]); got["md5"] != "def" || atomic.LoadInt32(&gets) != 1 {
+		t.Errorf("hashInfo() = %v with %d fs/get calls, want fetched hashes", got, gets)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 检查结果分类
+const (
+	CheckOK           = "ok"
+	CheckUnauthorized = "unauthorized" // 401/403
+	CheckNotFound     = "not-found"    // 404
+	CheckTimeout      = "timeout"
+	CheckWrongType    = "wrong-type" // 返回的内容不是媒体文件
+	CheckError        = "error"      // 其他错误
+)
+
+// CheckResult 记录一个strm文件的检查结果
+type CheckResult struct {
+	Strm        *Strm  `json:"-"`
+	Path        string `json:"path"`
+	RawURL      string `json:"raw_url"`
+	Status      string `json:"status"`
+	StatusCode  int    `json:"status_code"`
+	ContentType string `json:"content_type"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Valid 判断检查结果是否有效
+func (r *CheckResult) Valid() bool {
+	return r.Status == CheckOK
+}
+
+// isMediaContentType 判断Content-Type是否为可播放的媒体类型
+func isMediaContentType(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case contentType == "":
+		return true
+	case strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "audio/"):
+		return true
+	case contentType == "application/octet-stream", contentType == "binary/octet-stream",
+		contentType == "application/x-mpegurl", contentType == "application/vnd.apple.mpegurl",
+		contentType == "application/mp4", contentType == "application/x-matroska":
+		return true
+	}
+	return false
+}
+
+// Check 检查strm文件是否可以播放，ranged为true时使用Range GET读取少量数据确认服务器确实返回内容，否则使用HEAD
+func (s *Strm) Check(client *http.Client, ranged bool) *CheckResult {
+	result := &CheckResult{
+		Strm:   s,
+		Path:   s.LocalDir + "/" + s.Name,
+		RawURL: s.RawURL,
+	}
+	logger.Debugf("[MAIN]: checking %s", result.Path)
+	method := http.MethodHead
+	if ranged {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, s.RawURL, nil)
+	if err != nil {
+		result.Status, result.Error = CheckError, err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	if ranged {
+		req.Header.Set("Range", "bytes=0-1023")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			result.Status = CheckTimeout
+		} else {
+			result.Status = CheckError
+		}
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+	result.ContentType = resp.Header.Get("Content-Type")
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Status = CheckUnauthorized
+		return result
+	case resp.StatusCode == http.StatusNotFound:
+		result.Status = CheckNotFound
+		return result
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		result.Status, result.Error = CheckError, "unexpected status: "+resp.Status
+		return result
+	}
+	if !isMediaContentType(result.ContentType) {
+		result.Status = CheckWrongType
+		return result
+	}
+	if ranged {
+		n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				result.Status = CheckTimeout
+			} else {
+				result.Status = CheckError
+			}
+			result.Error = err.Error()
+			return result
+		}
+		if n == 0 {
+			result.Status, result.Error = CheckError, "no data received"
+			return result
+		}
+	}
+	result.Status = CheckOK
+	return result
+}
+
+// checkStrms 并发检查strm文件，结果顺序与输入一致
+func checkStrms(strms []*Strm, client *http.Client, workers int, ranged bool) []*CheckResult {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make([]*CheckResult, len(strms))
+	idxChan := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range idxChan {
+				results[idx] = strms[idx].Check(client, ranged)
+				logger.Increment()
+			}
+		}()
+	}
+	for i := range strms {
+		idxChan <- i
+	}
+	close(idxChan)
+	wg.Wait()
+	return results
+}
+
+// checkStrmsByAPI 通过alist接口检查strm文件对应的远程文件是否存在
+//
+// 按RemoteDir分组，每个远程目录只列出一次，避免每个链接都触发网盘生成下载地址。
+// 不属于当前服务器的strm文件无法通过接口检查，会回退为http检查。结果顺序与输入一致
+func checkStrmsByAPI(e Endpoint, strms []*Strm, workers int) ([]*CheckResult, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make([]*CheckResult, len(strms))
+	groups := make(map[string][]int)
+	foreign := make([]int, 0)
+	for i, s := range strms {
+		if s.Foreign {
+			foreign = append(foreign, i)
+			continue
+		}
+		groups[s.RemoteDir] = append(groups[s.RemoteDir], i)
+	}
+	if len(groups) > 0 {
+		client, err := newAlistClient(e)
+		if err != nil {
+			return nil, fmt.Errorf("login %s error: %s", e.BaseURL, err.Error())
+		}
+		logger.Infof("[MAIN]: check %d strm files in %d remote directories", len(strms)-len(foreign), len(groups))
+		dirChan := make(chan string)
+		wg := &sync.WaitGroup{}
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for dir := range dirChan {
+					checkRemoteDir(client, e, dir, strms, groups[dir], results)
+				}
+			}()
+		}
+		for dir := range groups {
+			dirChan <- dir
+		}
+		close(dirChan)
+		wg.Wait()
+	}
+	if len(foreign) > 0 {
+		logger.Infof("[MAIN]: %d foreign strm files will be checked by http", len(foreign))
+		client := newHTTPClient(e, config.Timeout)
+		for _, idx := range foreign {
+			results[idx] = strms[idx].Check(client, false)
+			logger.Increment()
+		}
+	}
+	return results, nil
+}
+
+// checkRemoteDir 列出一个远程目录并检查其中的strm文件，idxs为strms中属于该目录的下标
+func checkRemoteDir(client *AlistClient, e Endpoint, dir string, strms []*Strm, idxs []int, results []*CheckResult) {
+	files, err := client.List(dir, "", 1, 0, false)
+	names := make(map[string]bool, len(files))
+	for _, f := range files {
+		if !f.IsDir {
+			names[f.Name] = true
+		}
+	}
+	for _, idx := range idxs {
+		s := strms[idx]
+		result := &CheckResult{
+			Strm:   s,
+			Path:   s.LocalDir + "/" + s.Name,
+			RawURL: s.RawURL,
+		}
+		results[idx] = result
+		logger.Increment()
+		if err != nil {
+			// alist 对不存在的目录返回 object not found
+			if strings.Contains(strings.ToLower(err.Error()), "not found") {
+				result.Status = CheckNotFound
+			} else {
+				result.Status = CheckError
+			}
+			result.Error = err.Error()
+			continue
+		}
+		_, name, perr := parseStrmURL(s.RawURL, e.BaseURL)
+		if perr != nil {
+			result.Status, result.Error = CheckError, perr.Error()
+			continue
+		}
+		if !names[name] {
+			result.Status = CheckNotFound
+			result.Error = "file not found in " + dir
+			continue
+		}
+		result.Status = CheckOK
+	}
+}
+
+// writeCheckResults 将检查结果写入文件，format支持csv和json
+func writeCheckResults(file, format string, results []*CheckResult) error {
+	if format == "json" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if results == nil {
+			results = make([]*CheckResult, 0)
+		}
+		return enc.Encode(results)
+	}
+	lines := make([][]string, 0, len(results))
+	for _, r := range results {
+		lines = append(lines, []string{r.Path, r.Status, strconv.Itoa(r.StatusCode), r.ContentType, r.RawURL, r.Error})
+	}
+	return writeCSV(file, []string{"path", "status", "status_code", "content_type", "content", "error"}, lines)
+}
@@ -1,34 +1,51 @@
 package main
 
 type Config struct {
-	Database            string     `json:"database" yaml:"database"`
-	Endpoints           []Endpoint `json:"endpoints" yaml:"endpoints"`
-	Loglevel            string     `json:"loglevel" yaml:"loglevel"`
-	LogFile             string     `json:"log-file" yaml:"log-file"`
-	ColoredLog          bool       `json:"colored-log" yaml:"colored-log"`
-	Timeout             int        `json:"timeout" yaml:"timeout"`
-	Exts                []string   `json:"exts" yaml:"exts"`
-	AltExts             []string   `json:"alt-exts" yaml:"alt-exts"` // alternative extensions to copy to local directory
-	CreateSubDirectory  bool       `json:"create-sub-directory" yaml:"create-sub-directory"`
+	Database            string            `json:"database" yaml:"database"`
+	Endpoints           []Endpoint        `json:"endpoints" yaml:"endpoints"`
+	Loglevel            string            `json:"loglevel" yaml:"loglevel"`
+	LogFile             string            `json:"log-file" yaml:"log-file"`
+	ColoredLog          bool              `json:"colored-log" yaml:"colored-log"`
+	Timeout             int               `json:"timeout" yaml:"timeout"`
+	Exts                []string          `json:"exts" yaml:"exts"`
+	AltExts             []string          `json:"alt-exts" yaml:"alt-exts"`                 // alternative extensions to copy to local directory
+	AltExtPolicy        string            `json:"alt-ext-policy" yaml:"alt-ext-policy"`     // default policy for alternative files: once, sync, keep
+	AltExtPolicies      map[string]string `json:"alt-ext-policies" yaml:"alt-ext-policies"` // policy for each alternative extension
+	CreateSubDirectory  bool              `json:"create-sub-directory" yaml:"create-sub-directory"`
 	isIncrementalUpdate bool
 	records             map[string]int
+	organizeReport      *OrganizeReport
+	files               []string // 主配置文件和被包含的配置文件及目录，用于监听修改
 }
 
 type Endpoint struct {
-	BaseURL          string `json:"base-url" yaml:"base-url"`
-	Token            string `json:"token" yaml:"token"`
-	Username         string `json:"username" yaml:"username"`
-	Password         string `json:"password" yaml:"password"`
-	InscureTLSVerify bool   `json:"inscure-tls-verify" yaml:"inscure-tls-verify"`
-	Dirs             []Dir  `json:"dirs" yaml:"dirs"`
-	MaxConnections   int    `json:"max-connections" yaml:"max-connections"`
+	Name             string   `json:"name" yaml:"name"` // used by --endpoint to select endpoints
+	Tags             []string `json:"tags" yaml:"tags"` // used by --tag to select dirs, inherited by dirs
+	BaseURL          string   `json:"base-url" yaml:"base-url"`
+	Token            string   `json:"token" yaml:"token"`
+	TokenFile        string   `json:"token-file" yaml:"token-file"` // read token from file, e.g. docker secrets
+	Username         string   `json:"username" yaml:"username"`
+	Password         string   `json:"password" yaml:"password"`
+	PasswordFile     string   `json:"password-file" yaml:"password-file"` // read password from file, e.g. docker secrets
+	InscureTLSVerify bool     `json:"inscure-tls-verify" yaml:"inscure-tls-verify"`
+	Dirs             []Dir    `json:"dirs" yaml:"dirs"`
+	MaxConnections   int      `json:"max-connections" yaml:"max-connections"`
+	MaxDownloads     int      `json:"max-downloads" yaml:"max-downloads"` // concurrent downloads of alternative files
 }
 
 type Dir struct {
-	LocalDirectory     string   `json:"local-directory" yaml:"local-directory"`
-	RemoteDirectories  []string `json:"remote-directories" yaml:"remote-directories"`
-	NotRescursive      bool     `json:"not-recursive" yaml:"not-recursive"`
-	CreateSubDirectory bool     `json:"create-sub-directory" yaml:"create-sub-directory"`
-	Disabled           bool     `json:"disabled" yaml:"disabled"`
-	ForceRefresh       bool     `json:"force-refresh" yaml:"force-refresh"`
+	Name              string            `json:"name" yaml:"name"` // used by --dir to select dirs
+	Tags              []string          `json:"tags" yaml:"tags"` // used by --tag to select dirs
+	LocalDirectory    string            `json:"local-directory" yaml:"local-directory"`
+	RemoteDirectories []RemoteDirectory `json:"remote-directories" yaml:"remote-directories"`
+	NotRescursive     bool              `json:"not-recursive" yaml:"not-recursive"`
+	Disabled          bool              `json:"disabled" yaml:"disabled"`
+	Overrides         `yaml:",inline"`  // override global and endpoint settings
+	Filter            Filter            `json:"filter" yaml:"filter"`
+	MediaTypes        []string          `json:"media-types" yaml:"media-types"` // classify media by alist file type instead of extension: video, audio
+	Naming            Naming            `json:"naming" yaml:"naming"`
+	Organize          Organize          `json:"organize" yaml:"organize"`
+	NFO               NFO               `json:"nfo" yaml:"nfo"`           // write nfo stubs next to strm files
+	Grouping          Grouping          `json:"grouping" yaml:"grouping"` // name multi-version and multi-part strm files
+	Output            Output            `json:"output" yaml:"output"`     // output format: strm, kodi, m3u8, m3u
 }
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// TOML文件中的表头或键值对，用于没有扩展名时判断格式
+var tomlPattern = regexp.MustCompile(`^(\[[^\]]+\]|[A-Za-z0-9_"'-]+\s*=)`)
+
+// configFormat 根据扩展名判断配置文件格式，无法判断时根据内容判断
+func configFormat(configFile string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "{") {
+		return "json"
+	}
+	// 以第一个非注释行判断是否为TOML
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if tomlPattern.MatchString(line) {
+			return "toml"
+		}
+		break
+	}
+	return "yaml"
+}
+
+// isConfigFile 判断文件扩展名是否为支持的配置文件格式
+func isConfigFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		return true
+	}
+	return false
+}
+
+// readConfigData 按格式解析单个配置文件，返回统一为JSON类型的map，便于比较和合并
+func readConfigData(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.New("read config file error: " + err.Error())
+	}
+	raw := make(map[string]interface{})
+	format := configFormat(file, data)
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &raw)
+	case "toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		err = yaml.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s type config file %s error: %s", format, file, err.Error())
+	}
+	byts, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %s", file, err.Error())
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(byts, &m); err != nil {
+		return nil, fmt.Errorf("config file %s: %s", file, err.Error())
+	}
+	return m, nil
+}
+
+// resolveIncludes 解析include配置，路径相对于主配置文件所在目录，支持glob和目录，目录中的配置文件按文件名排序
+func resolveIncludes(configFile string, include interface{}) (files, dirs []string, err error) {
+	patterns := make([]string, 0)
+	switch v := include.(type) {
+	case nil:
+	case string:
+		patterns = append(patterns, v)
+	case []interface{}:
+		for _, p := range v {
+			s, ok := p.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("include must be a list of paths, got %v", p)
+			}
+			patterns = append(patterns, s)
+		}
+	default:
+		return nil, nil, fmt.Errorf("include must be a path or a list of paths, got %v", v)
+	}
+	base := filepath.Dir(configFile)
+	self, _ := filepath.Abs(configFile)
+	seen := map[string]bool{self: true}
+	add := func(file string) {
+		abs, _ := filepath.Abs(file)
+		if !seen[abs] {
+			seen[abs] = true
+			files = append(files, file)
+		}
+	}
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(base, pattern)
+		}
+		if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+			entries, err := os.ReadDir(pattern)
+			if err != nil {
+				return nil, nil, fmt.Errorf("read include directory error: %s", err.Error())
+			}
+			// ReadDir 返回的文件已按文件名排序
+			for _, entry := range entries {
+				if !entry.IsDir() && isConfigFile(entry.Name()) {
+					add(filepath.Join(pattern, entry.Name()))
+				}
+			}
+			dirs = append(dirs, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid include pattern %q: %s", pattern, err.Error())
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, nil, fmt.Errorf("include file %s not found", pattern)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			add(m)
+		}
+	}
+	return files, dirs, nil
+}
+
+// configMerger 合并多个配置文件
+// 主配置文件中的配置优先，被包含的文件中不同的值会被忽略；被包含的文件之间同一配置项的值不同时返回错误。
+// endpoints 按 base-url 合并，dirs 依次追加。
+type configMerger struct {
+	owners map[string]string // 配置项到设置它的被包含文件，不存在时为主配置文件
+}
+
+// set 设置一个配置项，field为配置项的完整名称
+func (m *configMerger) set(target map[string]interface{}, key string, value interface{}, field, file string) error {
+	old, ok := target[key]
+	if !ok {
+		target[key] = value
+		m.owners[field] = file
+		return nil
+	}
+	if reflect.DeepEqual(old, value) {
+		return nil
+	}
+	owner, ok := m.owners[field]
+	if !ok {
+		logger.Warnf("[MAIN]: %s in %s is overridden by main config file", field, file)
+		return nil
+	}
+	return fmt.Errorf("%s is set to different values in %s and %s", field, owner, file)
+}
+
+// merge 将被包含的配置文件合并到target中
+func (m *configMerger) merge(target, data map[string]interface{}, file string) error {
+	if _, ok := data["include"]; ok {
+		return fmt.Errorf("include is only supported in main config file, found in %s", file)
+	}
+	for k, v := range data {
+		if k == "endpoints" {
+			if err := m.mergeEndpoints(target, v, file); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.set(target, k, v, k, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeEndpoints 按 base-url 合并服务器配置，相同服务器的 dirs 追加到已有的列表中
+func (m *configMerger) mergeEndpoints(target map[string]interface{}, value interface{}, file string) error {
+	list, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("endpoints in %s must be a list", file)
+	}
+	endpoints, _ := target["endpoints"].([]interface{})
+	for i, v := range list {
+		e, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("endpoints[%d] in %s must be a map", i, file)
+		}
+		// 结尾的/不同时视为同一服务器，配置项的所有者也使用同一名称
+		baseURL, _ := e["base-url"].(string)
+		baseURL = strings.TrimRight(baseURL, "/")
+		var existing map[string]interface{}
+		for _, old := range endpoints {
+			if o, ok := old.(map[string]interface{}); ok && baseURL != "" {
+				if s, _ := o["base-url"].(string); strings.TrimRight(s, "/") == baseURL {
+					existing = o
+					break
+				}
+			}
+		}
+		if existing == nil {
+			for k := range e {
+				m.owners[fmt.Sprintf("endpoints[%s].%s", baseURL, k)] = file
+			}
+			endpoints = append(endpoints, e)
+			continue
+		}
+		for k, v := range e {
+			if k == "base-url" {
+				continue
+			}
+			if k == "dirs" {
+				dirs, ok := v.([]interface{})
+				if !ok {
+					return fmt.Errorf("endpoints[%d].dirs in %s must be a list", i, file)
+				}
+				old, _ := existing["dirs"].([]interface{})
+				existing["dirs"] = append(old, dirs...)
+				continue
+			}
+			if err := m.set(existing, k, v, fmt.Sprintf("endpoints[%s].%s", baseURL, k), file); err != nil {
+				return err
+			}
+		}
+	}
+	target["endpoints"] = endpoints
+	return nil
+}
+
+// readConfigFiles 读取主配置文件和include中的配置文件并合并，返回合并后的配置和需要监听修改的文件及目录
+func readConfigFiles(configFile string) (map[string]interface{}, []string, error) {
+	data, err := readConfigData(configFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, dirs, err := resolveIncludes(configFile, data["include"])
+	if err != nil {
+		return nil, nil, err
+	}
+	delete(data, "include")
+	m := &configMerger{owners: make(map[string]string)}
+	for _, file := range files {
+		included, err := readConfigData(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := m.merge(data, included, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, append(append([]string{configFile}, files...), dirs...), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigFormat(t *testing.T) {
+	tests := []struct {
+		file string
+		data string
+		want string
+	}{
+		{"config.json", "", "json"},
+		{"config.YAML", "", "yaml"},
+		{"config.yml", "", "yaml"},
+		{"Config.TOML", "", "toml"},
+		{"config", `  {"database": "strm.db"}`, "json"},
+		{"config", "# comment\n\ndatabase = \"strm.db\"\n", "toml"},
+		{"config", "[[endpoints]]\nbase-url = \"http://alist\"\n", "toml"},
+		{"config", "database: strm.db\n", "yaml"},
+		{"config.conf", "- a\n- b\n", "yaml"},
+		{"config.json", "database = \"strm.db\"", "json"},
+	}
+	for _, tt := range tests {
+		if got := configFormat(tt.file, []byte(tt.data)); got != tt.want {
+			t.Errorf("configFormat(%q, %q) = %q, want %q", tt.file, tt.data, got, tt.want)
+		}
+	}
+}
+
+// writeFiles 在目录中写入多个文件，文件名可以包含子目录
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.toml": `
+database = "strm.db"
+timeout = 30
+include = ["conf.d", "extra/*.json"]
+
+[[endpoints]]
+base-url = "http://alist:5244/"
+token = "token"
+
+  [[endpoints.dirs]]
+  local-directory = "media/movies"
+  remote-directories = ["/movies"]
+`,
+		"conf.d/01-shows.yaml": `
+timeout: 60
+endpoints:
+  - base-url: "http://alist:5244"
+    dirs:
+      - local-directory: media/shows
+        remote-directories: [/shows]
+`,
+		"conf.d/02-music.yml": `
+loglevel: debug
+endpoints:
+  - base-url: "http://music:5244"
+    dirs:
+      - local-directory: media/music
+        remote-directories: [/music]
+`,
+		"conf.d/notes.txt":  "not a config file",
+		"extra/colors.json": `{"colored-log": true}`,
+	})
+	data, files, err := readConfigFiles(filepath.Join(dir, "config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFiles := []string{
+		filepath.Join(dir, "config.toml"),
+		filepath.Join(dir, "conf.d", "01-shows.yaml"),
+		filepath.Join(dir, "conf.d", "02-music.yml"),
+		filepath.Join(dir, "extra", "colors.json"),
+		filepath.Join(dir, "conf.d"),
+	}
+	if !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("files = %v, want %v", files, wantFiles)
+	}
+	// 主配置文件优先
+	if data["timeout"] != float64(30) || data["loglevel"] != "debug" || data["colored-log"] != true {
+		t.Errorf("merged settings = %v", data)
+	}
+	if _, ok := data["include"]; ok {
+		t.Error("include should be removed after merging")
+	}
+	endpoints := data["endpoints"].([]interface{})
+	if len(endpoints) != 2 {
+		t.Fatalf("got %d endpoints, want 2", len(endpoints))
+	}
+	dirs := endpoints[0].(map[string]interface{})["dirs"].([]interface{})
+	if len(dirs) != 2 || dirs[1].(map[string]interface{})["local-directory"] != "media/shows" {
+		t.Errorf("dirs of first endpoint = %v, want movies and shows", dirs)
+	}
+}
+
+func TestReadConfigFilesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"conflict between included files", map[string]string{
+			"config.yaml": "include: [a.yaml, b.yaml]\n",
+			"a.yaml":      "timeout: 10\n",
+			"b.yaml":      "timeout: 20\n",
+		}, "timeout is set to different values"},
+		{"conflict between endpoints with trailing slash", map[string]string{
+			"config.yaml": "include: [a.yaml, b.yaml]\n",
+			"a.yaml":      "endpoints:\n  - base-url: http://alist:5244/\n    max-connections: 3\n",
+			"b.yaml":      "endpoints:\n  - base-url: http://alist:5244\n    max-connections: 5\n",
+		}, "endpoints[http://alist:5244].max-connections is set to different values"},
+		{"nested include", map[string]string{
+			"config.yaml": "include: a.yaml\n",
+			"a.yaml":      "include: b.yaml\n",
+		}, "include is only supported in main config file"},
+		{"missing file", map[string]string{
+			"config.yaml": "include: missing.yaml\n",
+		}, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			_, _, err := readConfigFiles(filepath.Join(dir, "config.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readConfigFiles() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
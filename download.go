@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+)
+
+const (
+	// 默认的下载并发数
+	defaultMaxDownloads = 2
+	// 下载失败后的重试次数，每次重试都会从已下载的位置继续
+	downloadRetries = 3
+	// 超过该大小的文件显示下载进度条
+	downloadBarThreshold = 1 << 20
+	// 任务没有设置超时时间时使用的默认值
+	defaultDownloadTimeout = 30 * time.Second
+)
+
+// 校验文件时优先使用的hash算法
+var hashPreference = []string{"sha256", "sha1", "md5"}
+
+// DownloadTask 一个额外文件的下载任务
+type DownloadTask struct {
+	URL      string
+	FilePath string
+	Size     int64
+	Hashes   map[string]string     // 远程文件的hash信息，为空时只校验文件大小
+	Timeout  time.Duration         // 连接、等待响应以及两次读取到数据之间的最长时间，为0时使用默认值
+	HashType string                // 校验使用的hash算法，下载成功后设置
+	Hash     string                // 校验通过的hash值，下载成功后设置
+	OnDone   func(t *DownloadTask) // 下载成功后调用
+}
+
+// Downloader 额外文件的下载队列，拥有独立的并发数限制
+type Downloader struct {
+	client   *http.Client
+	progress *mpb.Progress
+	tasks    chan *DownloadTask
+	wg       *sync.WaitGroup
+	mu       sync.Mutex
+	queued   map[string]bool // 已加入队列的本地路径，同一路径只下载一次，避免共用临时文件
+}
+
+// newDownloadClient 根据endpoint的配置创建下载使用的http客户端
+//
+// 不设置整体超时，避免大文件下载被中断，超时由每个任务按 DownloadTask.Timeout 控制
+func newDownloadClient(e Endpoint) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			DialContext:     (&net.Dialer{}).DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: e.InscureTLSVerify},
+		},
+	}
+}
+
+// idleReader 每次读取到数据时重置计时器，计时器到期时取消请求，避免连接卡住时一直阻塞
+type idleReader struct {
+	r       io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+// NewDownloader 创建一个下载队列并启动workers个下载线程，progress不为空时显示大文件的下载进度
+func NewDownloader(e Endpoint, workers int, progress *mpb.Progress) *Downloader {
+	if workers <= 0 {
+		workers = defaultMaxDownloads
+	}
+	d := &Downloader{
+		client:   newDownloadClient(e),
+		progress: progress,
+		tasks:    make(chan *DownloadTask, 1000),
+		wg:       &sync.WaitGroup{},
+		queued:   make(map[string]bool),
+	}
+	logger.Infof("[MAIN]: start downloader with %d threads", workers)
+	for i := 0; i < workers; i++ {
+		go d.run(i)
+	}
+	return d
+}
+
+// Add 添加下载任务，本地路径已在队列中时跳过
+func (d *Downloader) Add(t *DownloadTask) {
+	key := filepath.Clean(t.FilePath)
+	d.mu.Lock()
+	if d.queued[key] {
+		d.mu.Unlock()
+		logger.Warnf("[MAIN]: [%s] is already downloaded by another task, skip [%s]", t.FilePath, t.URL)
+		return
+	}
+	d.queued[key] = true
+	d.mu.Unlock()
+	d.wg.Add(1)
+	d.tasks <- t
+}
+
+// Wait 等待所有下载任务完成并停止下载线程
+func (d *Downloader) Wait() {
+	d.wg.Wait()
+	close(d.tasks)
+}
+
+func (d *Downloader) run(idx int) {
+	for t := range d.tasks {
+		var err error
+		for i := 0; i < downloadRetries; i++ {
+			if err = d.download(t); err == nil {
+				break
+			}
+			logger.Warnf("[download %2d]: download [%s] failed (%d/%d): %s", idx, t.URL, i+1, downloadRetries, err.Error())
+		}
+		if err != nil {
+			logger.Errorf("[download %2d]: give up downloading [%s]", idx, t.URL)
+		} else {
+			logger.Debugf("[download %2d]: successfully downloaded [%s] to [%s], size %d bytes", idx, t.URL, t.FilePath, t.Size)
+			if t.OnDone != nil {
+				t.OnDone(t)
+			}
+		}
+		d.wg.Done()
+	}
+}
+
+// download 下载文件到临时文件，完成并校验大小后重命名为目标文件
+//
+// 临时文件已存在时使用Range请求从已下载的位置继续下载，超过 t.Timeout 没有收到响应或数据时中断
+func (d *Downloader) download(t *DownloadTask) error {
+	if err := os.MkdirAll(filepath.Dir(t.FilePath), 0755); err != nil {
+		return fmt.Errorf("create directory [%s] error: %s", filepath.Dir(t.FilePath), err.Error())
+	}
+	partPath := t.FilePath + ".part"
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+		if offset > t.Size {
+			os.Remove(partPath)
+			offset = 0
+		}
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultDownloadTimeout
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	timer := time.AfterFunc(timeout, cancel)
+	defer timer.Stop()
+	// 请求只会因计时器到期被取消
+	stalled := func(err error) error {
+		if ctx.Err() != nil {
+			return fmt.Errorf("no data received in %s: %s", timeout, err.Error())
+		}
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request error: %s", err.Error())
+	}
+	// 设置常见的浏览器User-Agent
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	if offset > 0 && offset < t.Size {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return stalled(err)
+	}
+	defer resp.Body.Close()
+
+	flag := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flag |= os.O_APPEND
+		logger.Debugf("[MAIN]: resume downloading [%s] from %d bytes", t.URL, offset)
+	case resp.StatusCode == http.StatusOK:
+		// 服务器不支持断点续传，从头开始下载
+		flag |= os.O_TRUNC
+		offset = 0
+	default:
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	out, err := os.OpenFile(partPath, flag, 0644)
+	if err != nil {
+		return fmt.Errorf("create file [%s] error: %s", partPath, err.Error())
+	}
+	var body io.Reader = &idleReader{r: resp.Body, timer: timer, timeout: timeout}
+	var bar *mpb.Bar
+	if d.progress != nil && t.Size >= downloadBarThreshold {
+		bar = d.progress.AddBar(t.Size,
+			mpb.BarRemoveOnComplete(),
+			mpb.PrependDecorators(
+				decor.Name(filepath.Base(t.FilePath), decor.WC{W: 30, C: decor.DindentRight}),
+			),
+			mpb.AppendDecorators(
+				decor.CountersKibiByte("% .1f / % .1f"),
+			),
+		)
+		bar.SetCurrent(offset)
+		body = bar.ProxyReader(body)
+	}
+	_, err = io.Copy(out, body)
+	out.Close()
+	if bar != nil {
+		bar.Abort(true)
+	}
+	if err != nil {
+		return fmt.Errorf("write file [%s] error: %s", partPath, stalled(err).Error())
+	}
+
+	// 检查文件大小是否匹配
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return fmt.Errorf("get file info [%s] error: %s", partPath, err.Error())
+	}
+	if info.Size() != t.Size {
+		if info.Size() > t.Size {
+			os.Remove(partPath)
+		}
+		return fmt.Errorf("file size mismatch for [%s], expected %d but got %d", t.FilePath, t.Size, info.Size())
+	}
+	if err := t.verify(partPath); err != nil {
+		// 内容错误时无法续传，删除临时文件重新下载
+		os.Remove(partPath)
+		return err
+	}
+	return os.Rename(partPath, t.FilePath)
+}
+
+// verify 使用远程文件的hash信息校验已下载的文件
+func (t *DownloadTask) verify(file string) error {
+	for _, algo := range hashPreference {
+		want, ok := t.Hashes[algo]
+		if !ok {
+			continue
+		}
+		sum, err := fileHash(file, algo)
+		if err != nil {
+			return fmt.Errorf("calculate %s of [%s] error: %s", algo, file, err.Error())
+		}
+		if sum != want {
+			return fmt.Errorf("%s mismatch for [%s], expected %s but got %s", algo, t.FilePath, want, sum)
+		}
+		t.HashType, t.Hash = algo, sum
+		return nil
+	}
+	return nil
+}
+
+// fileHash 计算文件的hash值，algo支持md5、sha1、sha256
+func fileHash(file, algo string) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm: %s", algo)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
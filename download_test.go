@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadStalledBody(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("0123456789"))
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	defer srv.Close()
+	// 先于srv.Close结束处理函数
+	defer close(release)
+
+	d := &Downloader{client: newDownloadClient(Endpoint{})}
+	task := &DownloadTask{
+		URL:      srv.URL + "/d/a.srt",
+		FilePath: filepath.Join(t.TempDir(), "a.srt"),
+		Size:     100,
+		Timeout:  200 * time.Millisecond,
+	}
+	done := make(chan error, 1)
+	go func() { done <- d.download(task) }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "no data received") {
+			t.Fatalf("download() error = %v, want stalled error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("download() blocked on a stalled body")
+	}
+	// 已下载的部分保留用于续传
+	if info, err := os.Stat(task.FilePath + ".part"); err != nil || info.Size() != 10 {
+		t.Errorf("part file = %v, %v, want 10 bytes", info, err)
+	}
+}
+
+func TestDownloaderSkipsDuplicatePath(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	d := NewDownloader(Endpoint{}, 2, nil)
+	dir := t.TempDir()
+	for _, name := range []string{"a.srt", "b.srt"} {
+		d.Add(&DownloadTask{URL: srv.URL + "/d/" + name, FilePath: filepath.Join(dir, "./Movie.srt"), Size: 4})
+	}
+	d.Wait()
+	if hits != 1 {
+		t.Errorf("server hits = %d, want 1", hits)
+	}
+}
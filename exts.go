@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 目录扩展名与全局扩展名的合并方式
+const (
+	ExtsModeOverride = "override" // 目录的扩展名替换全局扩展名
+	ExtsModeExtend   = "extend"   // 目录的扩展名追加到全局扩展名
+)
+
+// alist 返回的文件类型，0为未知，1为目录
+var alistFileTypes = map[string]int{
+	"video": 2,
+	"audio": 3,
+	"text":  4,
+	"image": 5,
+}
+
+// normalizeExt 统一扩展名格式为小写并以.开头，如 MKV、.Mkv 都转换为 .mkv
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// normalizeExts 统一扩展名格式并去除空值和重复值
+func normalizeExts(exts ...[]string) []string {
+	res := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, list := range exts {
+		for _, v := range list {
+			v = normalizeExt(v)
+			if v == "" || seen[v] {
+				continue
+			}
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// resolveExts 根据合并方式计算实际使用的扩展名，inherited为上一层的扩展名
+func (o Overrides) resolveExts(inherited, local []string) []string {
+	if len(local) == 0 {
+		return normalizeExts(inherited)
+	}
+	if o.ExtsMode == ExtsModeExtend {
+		return normalizeExts(inherited, local)
+	}
+	return normalizeExts(local)
+}
+
+// MediaFileTypes 将目录配置的媒体类型名称转换为alist的文件类型
+func (d Dir) MediaFileTypes() ([]int, error) {
+	types := make([]int, 0, len(d.MediaTypes))
+	for _, v := range d.MediaTypes {
+		t, ok := alistFileTypes[strings.ToLower(strings.TrimSpace(v))]
+		if !ok {
+			return nil, fmt.Errorf("unknown media type %q, support: video, audio, text, image", v)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
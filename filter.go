@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/imshuai/alistsdk-go"
+)
+
+// Filter 目录的过滤规则，在生成strm或进入子目录前判断
+type Filter struct {
+	Include        []string `json:"include" yaml:"include"`                 // glob规则，包含/时匹配完整远程路径，否则匹配文件名，设置后只保留匹配的文件
+	Exclude        []string `json:"exclude" yaml:"exclude"`                 // glob规则，排除匹配的文件
+	IncludeRegex   []string `json:"include-regex" yaml:"include-regex"`     // 正则规则，匹配完整远程路径，设置后只保留匹配的文件
+	ExcludeRegex   []string `json:"exclude-regex" yaml:"exclude-regex"`     // 正则规则，排除匹配的文件或目录
+	ExcludeDirs    []string `json:"exclude-dirs" yaml:"exclude-dirs"`       // 排除的目录名，支持glob，如 @eaDir、extras
+	MinSize        string   `json:"min-size" yaml:"min-size"`               // 最小文件大小，如 100MB，用于跳过样片和预告片
+	MaxSize        string   `json:"max-size" yaml:"max-size"`               // 最大文件大小
+	ModifiedAfter  string   `json:"modified-after" yaml:"modified-after"`   // 只保留在此之后修改的文件，支持日期(2006-01-02)、RFC3339时间或相对时长(如 30d、12h)
+	ModifiedBefore string   `json:"modified-before" yaml:"modified-before"` // 只保留在此之前修改的文件，格式同上
+}
+
+// FileFilter 编译后的过滤规则
+type FileFilter struct {
+	include        []string
+	exclude        []string
+	includeRegex   []*regexp.Regexp
+	excludeRegex   []*regexp.Regexp
+	excludeDirs    []string
+	minSize        int64
+	maxSize        int64
+	modifiedAfter  time.Time
+	modifiedBefore time.Time
+}
+
+// Compile 检查并编译过滤规则
+func (f Filter) Compile() (*FileFilter, error) {
+	ff := &FileFilter{
+		include:     f.Include,
+		exclude:     f.Exclude,
+		excludeDirs: f.ExcludeDirs,
+	}
+	for _, patterns := range [][]string{f.Include, f.Exclude, f.ExcludeDirs} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q: %s", p, err.Error())
+			}
+		}
+	}
+	var err error
+	if ff.includeRegex, err = compileRegexps(f.IncludeRegex); err != nil {
+		return nil, err
+	}
+	if ff.excludeRegex, err = compileRegexps(f.ExcludeRegex); err != nil {
+		return nil, err
+	}
+	if ff.minSize, err = parseSize(f.MinSize); err != nil {
+		return nil, fmt.Errorf("invalid min-size: %s", err.Error())
+	}
+	if ff.maxSize, err = parseSize(f.MaxSize); err != nil {
+		return nil, fmt.Errorf("invalid max-size: %s", err.Error())
+	}
+	if ff.modifiedAfter, err = parseTimeOrDuration(f.ModifiedAfter); err != nil {
+		return nil, fmt.Errorf("invalid modified-after: %s", err.Error())
+	}
+	if ff.modifiedBefore, err = parseTimeOrDuration(f.ModifiedBefore); err != nil {
+		return nil, fmt.Errorf("invalid modified-before: %s", err.Error())
+	}
+	return ff, nil
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %s", p, err.Error())
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// parseSize 解析文件大小，支持 B、K/KB、M/MB、G/GB、T/TB 后缀，按1024进位，空字符串返回0
+func parseSize(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	unit := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// parseTimeOrDuration 解析日期、RFC3339时间或相对现在的时长(支持d表示天)，空字符串返回零值
+func parseTimeOrDuration(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor a duration", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// parseDuration 解析时长，在time.ParseDuration的基础上支持d表示天
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// matchGlobs 判断远程路径或文件名是否匹配任一glob规则
+func matchGlobs(patterns []string, remotePath, name string) bool {
+	for _, p := range patterns {
+		target := name
+		if strings.Contains(p, "/") {
+			target = remotePath
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegexps(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowDir 判断是否进入远程目录
+func (ff *FileFilter) AllowDir(remotePath, name string) bool {
+	if ff == nil {
+		return true
+	}
+	if matchGlobs(ff.excludeDirs, remotePath, name) {
+		return false
+	}
+	return !matchRegexps(ff.excludeRegex, remotePath)
+}
+
+// AllowFile 判断是否为远程文件生成strm
+func (ff *FileFilter) AllowFile(remotePath string, f sdk.File) bool {
+	if ff == nil {
+		return true
+	}
+	if len(ff.include) > 0 && !matchGlobs(ff.include, remotePath, f.Name) {
+		return false
+	}
+	if len(ff.includeRegex) > 0 && !matchRegexps(ff.includeRegex, remotePath) {
+		return false
+	}
+	if matchGlobs(ff.exclude, remotePath, f.Name) || matchRegexps(ff.excludeRegex, remotePath) {
+		return false
+	}
+	if ff.minSize > 0 && f.Size < ff.minSize {
+		return false
+	}
+	if ff.maxSize > 0 && f.Size > ff.maxSize {
+		return false
+	}
+	if !ff.modifiedAfter.IsZero() || !ff.modifiedBefore.IsZero() {
+		modified, err := time.Parse(time.RFC3339Nano, f.Modified)
+		if err != nil {
+			// 无法解析修改时间时不按时间过滤
+			return true
+		}
+		if !ff.modifiedAfter.IsZero() && modified.Before(ff.modifiedAfter) {
+			return false
+		}
+		if !ff.modifiedBefore.IsZero() && modified.After(ff.modifiedBefore) {
+			return false
+		}
+	}
+	return true
+}
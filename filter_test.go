@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"100", 100, false},
+		{"100B", 100, false},
+		{"1K", 1 << 10, false},
+		{"1kb", 1 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{"2GiB", 2 << 30, false},
+		{" 10 mb ", 10 << 20, false},
+		{"1T", 1 << 40, false},
+		{"-1", 0, true},
+		{"abc", 0, true},
+		{"MB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/boltdb/bolt"
+	sdk "github.com/imshuai/alistsdk-go"
+)
+
+// 修复动作
+const (
+	FixRewrite    = "rewrite"    // 找到了改名或移动后的文件，重写strm内容
+	FixQuarantine = "quarantine" // 未找到对应文件，移动到隔离目录
+)
+
+// FixRecord 记录一次对无效strm文件的修复
+type FixRecord struct {
+	Path   string    `json:"path"`
+	OldURL string    `json:"old_url"`
+	NewURL string    `json:"new_url,omitempty"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"` // 隔离后的文件路径
+	Time   time.Time `json:"time"`
+}
+
+// Save 保存修复记录
+func (r *FixRecord) Save() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("fix"))
+		if err != nil {
+			return err
+		}
+		byts, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(r.Time.Format(time.RFC3339Nano)+" "+r.Path), byts)
+	})
+}
+
+// fixable 判断检查结果是否需要修复，权限和超时等问题可能是暂时的，不做处理
+func fixable(r *CheckResult) bool {
+	return r.Status == CheckNotFound || r.Status == CheckWrongType
+}
+
+// normalizeName 去除扩展名、大小写和标点的差异，用于匹配改名后的文件
+func normalizeName(name string) string {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// Fixer 通过alist接口查找无效strm文件对应的远程文件
+type Fixer struct {
+	endpoint   Endpoint
+	client     *AlistClient
+	quarantine string
+	dryRun     bool
+	listings   map[string][]sdk.File // 缓存已列出的远程目录
+}
+
+// NewFixer 创建一个新的Fixer
+func NewFixer(e Endpoint, quarantine string, dryRun bool) (*Fixer, error) {
+	client, err := newAlistClient(e)
+	if err != nil {
+		return nil, err
+	}
+	return &Fixer{
+		endpoint:   e,
+		client:     client,
+		quarantine: quarantine,
+		dryRun:     dryRun,
+		listings:   make(map[string][]sdk.File),
+	}, nil
+}
+
+// list 列出远程目录中的文件，结果会被缓存
+func (f *Fixer) list(dir string) ([]sdk.File, error) {
+	if files, ok := f.listings[dir]; ok {
+		return files, nil
+	}
+	files, err := f.client.List(dir, "", 1, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	f.listings[dir] = files
+	return files, nil
+}
+
+// dirOf 返回strm所在的目录和对应的远程目录
+func (f *Fixer) dirOf(s *Strm) (Dir, RemoteDirectory, bool) {
+	for _, d := range f.endpoint.Dirs {
+		if d.Disabled || !inLocalDir(s.LocalDir, d.LocalDirectory) {
+			continue
+		}
+		for _, r := range d.RemoteDirectories {
+			if inRemoteDir(s.RemoteDir, r.Path) {
+				return d, r, true
+			}
+		}
+	}
+	return Dir{}, RemoteDirectory{}, false
+}
+
+// mediaRules 返回strm所在目录判断媒体文件的扩展名和文件类型，与生成strm时相同，
+// 使用目录和远程目录的覆盖设置；找不到所在目录时使用服务器的设置
+func (f *Fixer) mediaRules(s *Strm) ([]string, []int) {
+	if d, r, ok := f.dirOf(s); ok {
+		// 媒体类型错误时由Validate报告
+		types, _ := d.MediaFileTypes()
+		return d.Settings(f.endpoint, r).Exts, types
+	}
+	return config.baseSettings(f.endpoint).Exts, nil
+}
+
+// remap 按strm所在目录的输出模式，将本地路径映射到新的远程文件name，链接的文件名使用新文件的扩展名
+func (f *Fixer) remap(s *Strm, name string) error {
+	d, _, ok := f.dirOf(s)
+	if !ok {
+		if s.LocalPath != "" || s.Format == ModeSymlink || s.Format == ModeHardlink {
+			return fmt.Errorf("no dir in config contains %s", s.LocalDir)
+		}
+		return nil
+	}
+	output, err := d.Output.Compile()
+	if err != nil {
+		return err
+	}
+	if output.Mode == ModeURL {
+		s.LocalPath = ""
+		return nil
+	}
+	if s.LocalPath, err = output.localPathOf(path.Join(s.RemoteDir, name)); err != nil {
+		return err
+	}
+	if output.IsLink() {
+		s.Name = strings.TrimSuffix(s.Name, filepath.Ext(s.Name)) + filepath.Ext(name)
+	}
+	return nil
+}
+
+// findReplacement 在strm原来所在的远程目录中查找改名后的文件，优先匹配文件名，其次匹配数据库中记录的文件大小
+func (f *Fixer) findReplacement(s *Strm) (string, bool) {
+	files, err := f.list(s.RemoteDir)
+	if err != nil {
+		logger.Debugf("[MAIN]: list remote directory [%s] error: %s", s.RemoteDir, err.Error())
+		return "", false
+	}
+	_, oldName, err := parseStrmURL(s.RawURL, f.endpoint.BaseURL)
+	if err != nil {
+		return "", false
+	}
+	var size int64
+	if stored, err := GetStrm(s.RawURL); err == nil {
+		size = stored.Size
+	}
+	exts, types := f.mediaRules(s)
+	candidates := make([]sdk.File, 0)
+	for _, file := range files {
+		if !file.IsDir && isMediaFile(file, exts, types) && file.Name != oldName {
+			candidates = append(candidates, file)
+		}
+	}
+	for _, file := range candidates {
+		if normalizeName(file.Name) == normalizeName(oldName) {
+			return file.Name, true
+		}
+	}
+	if size > 0 {
+		for _, file := range candidates {
+			if file.Size == size {
+				return file.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Fix 修复一个无效的strm文件，找到对应文件时重写strm内容，否则移动到隔离目录
+func (f *Fixer) Fix(s *Strm) (*FixRecord, error) {
+	record := &FixRecord{
+		Path:   filepath.Join(s.LocalDir, s.Name),
+		OldURL: s.RawURL,
+		Time:   time.Now(),
+	}
+	if name, ok := f.findReplacement(s); ok {
+		record.Action = FixRewrite
+		record.NewURL = strings.TrimRight(f.endpoint.BaseURL, "/") + "/d" + path.Join(s.RemoteDir, name)
+		if f.dryRun {
+			return record, nil
+		}
+		old := *s
+		s.RawURL = record.NewURL
+		// local、symlink、hardlink模式下文件中是本地路径，需要同时更新
+		if err := f.remap(s, name); err != nil {
+			return nil, err
+		}
+		if s.Format == FormatM3U || s.Name != old.Name {
+			// 播放列表中先删除旧的条目，链接的扩展名变化时删除旧的链接
+			if err := writerOf(s.Format).Remove(&old); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.GenStrm(true); err != nil {
+			return nil, err
+		}
+		if err := deleteStrmKey(old.Key()); err != nil {
+			logger.Warnf("[MAIN]: delete strm info %s failed: %s", old.RawURL, err)
+		}
+		if err := s.Save(); err != nil {
+			logger.Warnf("[MAIN]: save strm info %s failed: %s", s.RawURL, err)
+		}
+	} else {
+		record.Action = FixQuarantine
+		record.Target = filepath.Join(f.quarantine, strings.TrimPrefix(record.Path, filepath.VolumeName(record.Path)))
+		if f.dryRun {
+			return record, nil
+		}
+		if s.Format == FormatM3U {
+			// 播放列表中只隔离无效的条目
+			record.Target = filepath.Join(filepath.Dir(record.Target), s.title()+".strm")
+		}
+		if err := os.MkdirAll(filepath.Dir(record.Target), 0755); err != nil {
+			return nil, err
+		}
+		if s.Format == FormatM3U {
+			if err := os.WriteFile(record.Target, []byte(s.RawURL), 0666); err != nil {
+				return nil, err
+			}
+			if err := writerOf(s.Format).Remove(s); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := os.Rename(record.Path, record.Target); err != nil {
+				return nil, err
+			}
+			if err := quarantineSidecars(s, filepath.Dir(record.Target)); err != nil {
+				return nil, err
+			}
+		}
+		if err := deleteStrmKey(s.Key()); err != nil {
+			logger.Warnf("[MAIN]: delete strm info %s failed: %s", s.RawURL, err)
+		}
+	}
+	return record, record.Save()
+}
+
+// quarantineSidecars 将属于strm的nfo和额外文件（按 isSidecarOf 判断）一起移动到隔离目录，并删除数据库中的记录，
+// 避免下次运行时与其他strm重新配对。需要在strm文件移动后调用，同名的其他strm和链接文件不会被移动
+func quarantineSidecars(s *Strm, targetDir string) error {
+	entries, err := os.ReadDir(s.LocalDir)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(s.Name, filepath.Ext(s.Name))
+	for _, e := range entries {
+		src := filepath.Join(s.LocalDir, e.Name())
+		if e.IsDir() || !isSidecarOf(e.Name(), base) || isStrmFile(e.Name()) || getLinkRecord(src) != nil {
+			continue
+		}
+		if err := os.Rename(src, filepath.Join(targetDir, e.Name())); err != nil {
+			return err
+		}
+		// 文件已经移动，Delete只删除记录
+		if sidecar := GetSidecar(src); sidecar != nil {
+			if err := sidecar.Delete(); err != nil {
+				logger.Warnf("[MAIN]: delete sidecar record %s failed: %s", src, err)
+			}
+		}
+		if record := GetNFORecord(src); record != nil {
+			if err := record.Delete(); err != nil {
+				logger.Warnf("[MAIN]: delete nfo record %s failed: %s", src, err)
+			}
+		}
+		logger.Infof("[MAIN]: quarantine %s to %s", src, targetDir)
+	}
+	return nil
+}
+
+// deleteStrmKey 从数据库中删除strm信息
+func deleteStrmKey(key string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("strm"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// fixStrms 修复检查结果中可以修复的strm文件
+func fixStrms(e Endpoint, results []*CheckResult, quarantine string, dryRun bool) (rewritten, quarantined int, err error) {
+	var fixer *Fixer
+	for _, r := range results {
+		if !fixable(r) || r.Strm.Foreign {
+			continue
+		}
+		if fixer == nil {
+			fixer, err = NewFixer(e, quarantine, dryRun)
+			if err != nil {
+				return 0, 0, fmt.Errorf("login %s error: %s", e.BaseURL, err.Error())
+			}
+		}
+		record, err := fixer.Fix(r.Strm)
+		if err != nil {
+			logger.Warnf("[MAIN]: fix %s failed: %s", r.Path, err)
+			continue
+		}
+		switch record.Action {
+		case FixRewrite:
+			rewritten++
+			logger.Infof("[MAIN]: %s rewritten to %s", record.Path, record.NewURL)
+		case FixQuarantine:
+			quarantined++
+			logger.Infof("[MAIN]: %s moved to %s", record.Path, record.Target)
+		}
+	}
+	return rewritten, quarantined, nil
+}
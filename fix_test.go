@@ -0,0 +1,186 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	sdk "github.com/imshuai/alistsdk-go"
+)
+
+func TestFixerMediaRules(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	config = &Config{Exts: []string{".mkv"}}
+
+	e := Endpoint{
+		BaseURL: "http://alist:5244",
+		Dirs: []Dir{
+			{
+				LocalDirectory: "./media/movies/",
+				RemoteDirectories: []RemoteDirectory{
+					{Path: "/movies"},
+					{Path: "/movies-4k/", Overrides: Overrides{Exts: []string{".ts"}, ExtsMode: ExtsModeExtend}},
+				},
+				Overrides: Overrides{Exts: []string{".mp4"}},
+			},
+			{
+				LocalDirectory:    "media/music",
+				RemoteDirectories: []RemoteDirectory{{Path: "/music"}},
+				MediaTypes:        []string{"audio"},
+			},
+		},
+	}
+	f := &Fixer{endpoint: e}
+	tests := []struct {
+		name      string
+		localDir  string
+		remoteDir string
+		exts      []string
+		types     []int
+	}{
+		{"dir override", "media/movies/A", "/movies/A", []string{".mp4"}, nil},
+		{"remote directory extend", "media/movies", "/movies-4k", []string{".mp4", ".ts"}, nil},
+		{"media types", "media/music/B", "/music/B", []string{".mkv"}, []int{alistFileTypes["audio"]}},
+		{"not in any dir", "other", "/other", []string{".mkv"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exts, types := f.mediaRules(&Strm{LocalDir: tt.localDir, RemoteDir: tt.remoteDir})
+			if !reflect.DeepEqual(exts, tt.exts) || len(types) != len(tt.types) || len(types) > 0 && types[0] != tt.types[0] {
+				t.Errorf("mediaRules() = %v, %v, want %v, %v", exts, types, tt.exts, tt.types)
+			}
+		})
+	}
+}
+
+// openTestDB 在临时目录中打开数据库，测试结束后关闭
+func openTestDB(t *testing.T) {
+	t.Helper()
+	var err error
+	if db, err = bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		db = nil
+	})
+}
+
+func TestFixerFixRemapsLocalPath(t *testing.T) {
+	openTestDB(t)
+	old := config
+	defer func() { config = old }()
+	config = &Config{Exts: []string{".mkv", ".mp4"}}
+
+	tmp := t.TempDir()
+	mount := filepath.Join(tmp, "mnt")
+	if err := os.MkdirAll(mount, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mount, "The.Movie.mp4"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newDir := func(local, mode string) Dir {
+		return Dir{
+			LocalDirectory:    local,
+			RemoteDirectories: []RemoteDirectory{{Path: "/movies"}},
+			Output:            Output{Mode: mode, PathMapping: map[string]string{"/movies": mount}},
+		}
+	}
+	e := Endpoint{
+		BaseURL: "http://alist:5244",
+		Dirs:    []Dir{newDir(filepath.Join(tmp, "local"), ModeLocal), newDir(filepath.Join(tmp, "link"), ModeSymlink)},
+	}
+	f := &Fixer{
+		endpoint:   e,
+		quarantine: filepath.Join(tmp, "quarantine"),
+		listings:   map[string][]sdk.File{"/movies": {{Name: "The.Movie.mp4", Size: 5}}},
+	}
+	oldURL := "http://alist:5244/d/movies/The Movie.mkv"
+	newURL := "http://alist:5244/d/movies/The.Movie.mp4"
+	newPath := filepath.Join(mount, "The.Movie.mp4")
+
+	t.Run("local", func(t *testing.T) {
+		s := &Strm{Name: "The Movie.strm", LocalDir: e.Dirs[0].LocalDirectory, RemoteDir: "/movies", RawURL: oldURL, Format: FormatStrm, LocalPath: filepath.Join(mount, "The Movie.mkv")}
+		if err := s.GenStrm(true); err != nil {
+			t.Fatal(err)
+		}
+		record, err := f.Fix(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Action != FixRewrite || record.NewURL != newURL {
+			t.Fatalf("Fix() = %+v, want rewrite to %s", record, newURL)
+		}
+		content, _ := os.ReadFile(filepath.Join(s.LocalDir, "The Movie.strm"))
+		if string(content) != newPath {
+			t.Errorf("strm content = %q, want %q", content, newPath)
+		}
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		// 读取本地链接文件时LocalPath为空
+		s := &Strm{Name: "The Movie.mkv", LocalDir: e.Dirs[1].LocalDirectory, RemoteDir: "/movies", RawURL: oldURL, Format: ModeSymlink, LocalPath: filepath.Join(mount, "The Movie.mkv")}
+		if err := s.GenStrm(true); err != nil {
+			t.Fatal(err)
+		}
+		s.LocalPath = ""
+		if _, err := f.Fix(s); err != nil {
+			t.Fatal(err)
+		}
+		if target, err := os.Readlink(filepath.Join(s.LocalDir, "The Movie.mp4")); err != nil || target != newPath {
+			t.Errorf("link target = %q, %v, want %q", target, err, newPath)
+		}
+		if _, err := os.Lstat(filepath.Join(s.LocalDir, "The Movie.mkv")); !os.IsNotExist(err) {
+			t.Errorf("old link still exists: %v", err)
+		}
+		if record := getLinkRecord(filepath.Join(s.LocalDir, "The Movie.mp4")); record == nil || record.RawURL != newURL {
+			t.Errorf("link record = %+v, want %s", record, newURL)
+		}
+	})
+}
+
+func TestFixerQuarantineSidecars(t *testing.T) {
+	openTestDB(t)
+	old := config
+	defer func() { config = old }()
+	config = &Config{Exts: []string{".mkv"}}
+	tmp := t.TempDir()
+	local := filepath.Join(tmp, "local")
+	quarantine := filepath.Join(tmp, "quarantine")
+	s := &Strm{Name: "Movie.strm", LocalDir: local, RemoteDir: "/movies", RawURL: "http://alist:5244/d/movies/Movie.mkv", Format: FormatStrm}
+	if err := s.GenStrm(true); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"Movie.nfo": "nfo", "Movie.chs.srt": "srt", "Movie-poster.jpg": "jpg", "Movie 2.strm": "http://alist:5244/d/movies/Movie 2.mkv", "poster.jpg": "jpg"}
+	writeFiles(t, local, files)
+	sidecar := &Sidecar{LocalPath: filepath.Join(local, "Movie.chs.srt"), RemotePath: "/movies/Movie.chs.srt"}
+	if err := sidecar.Save(); err != nil {
+		t.Fatal(err)
+	}
+	f := &Fixer{endpoint: Endpoint{BaseURL: "http://alist:5244"}, quarantine: quarantine, listings: map[string][]sdk.File{"/movies": {}}}
+	record, err := f.Fix(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Action != FixQuarantine {
+		t.Fatalf("Fix() action = %s, want %s", record.Action, FixQuarantine)
+	}
+	target := filepath.Dir(record.Target)
+	for _, name := range []string{"Movie.strm", "Movie.nfo", "Movie.chs.srt", "Movie-poster.jpg"} {
+		if _, err := os.Stat(filepath.Join(target, name)); err != nil {
+			t.Errorf("%s not quarantined: %v", name, err)
+		}
+	}
+	for _, name := range []string{"Movie 2.strm", "poster.jpg"} {
+		if _, err := os.Stat(filepath.Join(local, name)); err != nil {
+			t.Errorf("%s should stay: %v", name, err)
+		}
+	}
+	if GetSidecar(sidecar.LocalPath) != nil {
+		t.Error("sidecar record of quarantined file still exists")
+	}
+}
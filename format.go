@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 输出格式
+const (
+	FormatStrm = "strm" // 只包含链接的 .strm 文件
+	FormatKodi = "kodi" // 带有 #KODIPROP 头的 .strm 文件
+	FormatM3U8 = "m3u8" // 只包含一个条目的 .m3u8 播放列表
+	FormatM3U  = "m3u"  // 每个目录一个 .m3u 播放列表，按集数排序
+)
+
+// Output 目录的输出格式
+type Output struct {
+	Format      string            `json:"format" yaml:"format"`             // strm (默认)、kodi、m3u8、m3u
+	KodiProps   map[string]string `json:"kodi-props" yaml:"kodi-props"`     // kodi 格式写入的 #KODIPROP，如 inputstream: inputstream.ffmpegdirect
+	Mode        string            `json:"mode" yaml:"mode"`                 // url (默认)、local、symlink、hardlink
+	PathMapping map[string]string `json:"path-mapping" yaml:"path-mapping"` // 远程路径前缀到本地挂载路径前缀的映射，如 /115: /mnt/alist/115
+}
+
+// Compile 检查输出格式，未配置时使用strm格式和url模式
+func (o Output) Compile() (*Output, error) {
+	o.Format = strings.ToLower(strings.TrimSpace(o.Format))
+	switch o.Format {
+	case "":
+		o.Format = FormatStrm
+	case FormatStrm, FormatKodi, FormatM3U8, FormatM3U:
+	default:
+		return nil, fmt.Errorf("unknown output format %q, support: strm, kodi, m3u8, m3u", o.Format)
+	}
+	if err := o.compileMode(); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// Apply 按输出格式设置strm的格式、文件名和本地路径，fileName为远程文件名，需要在命名、整理和多版本规则之后调用
+func (o *Output) Apply(s *Strm, fileName string) error {
+	if o == nil {
+		return nil
+	}
+	s.Format = o.Format
+	s.KodiProps = o.KodiProps
+	if o.Mode != ModeURL {
+		localPath, err := o.localPathOf(s.RemoteDir + "/" + fileName)
+		if err != nil {
+			return err
+		}
+		s.LocalPath = localPath
+	}
+	switch {
+	case o.IsLink():
+		// 链接使用远程文件的扩展名
+		s.Format = o.Mode
+		s.Name = strings.TrimSuffix(s.Name, filepath.Ext(s.Name)) + filepath.Ext(fileName)
+	case o.Format == FormatM3U8:
+		s.Name = strings.TrimSuffix(s.Name, filepath.Ext(s.Name)) + ".m3u8"
+	case o.Format == FormatM3U:
+		s.Name = path.Base(s.LocalDir) + ".m3u"
+	}
+	return nil
+}
+
+// isStrmFile 判断文件是否为本程序可以读取的输出文件
+func isStrmFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".strm", ".m3u8", ".m3u":
+		return true
+	}
+	return false
+}
+
+// strmWriter 将Strm对象写入本地文件
+type strmWriter interface {
+	// Write 写入文件，overwrite为false时文件或条目已存在返回错误
+	Write(s *Strm, overwrite bool) error
+	// Remove 删除文件或条目
+	Remove(s *Strm) error
+}
+
+// writerOf 根据格式返回对应的writer
+func writerOf(format string) strmWriter {
+	switch format {
+	case FormatM3U:
+		return playlistWriter{}
+	case ModeSymlink, ModeHardlink:
+		return linkWriter{hard: format == ModeHardlink}
+	default:
+		return fileWriter{}
+	}
+}
+
+// fileWriter 每个Strm对象对应一个文件
+type fileWriter struct{}
+
+func (fileWriter) Write(s *Strm, overwrite bool) error {
+	file := path.Join(s.LocalDir, s.Name)
+	_, err := os.Stat(file)
+	if !overwrite && !os.IsNotExist(err) {
+		return fmt.Errorf("file %s already exists and overwrite is false", file)
+	}
+	return os.WriteFile(file, []byte(s.content()), 0666)
+}
+
+func (fileWriter) Remove(s *Strm) error {
+	return os.RemoveAll(path.Join(s.LocalDir, s.Name))
+}
+
+// content 生成单个文件格式的内容
+func (s *Strm) content() string {
+	switch s.Format {
+	case FormatKodi:
+		keys := make([]string, 0, len(s.KodiProps))
+		for k := range s.KodiProps {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		lines := make([]string, 0, len(keys)+1)
+		for _, k := range keys {
+			lines = append(lines, fmt.Sprintf("#KODIPROP:%s=%s", k, s.KodiProps[k]))
+		}
+		return strings.Join(append(lines, s.target()), "\n")
+	case FormatM3U8:
+		return fmt.Sprintf("#EXTM3U\n#EXTINF:-1,%s\n%s\n", s.title(), s.target())
+	default:
+		return s.target()
+	}
+}
+
+// title 播放列表中显示的标题，为远程文件名或本地文件名去除扩展名
+func (s *Strm) title() string {
+	_, name, err := parseStrmURL(s.RawURL, "")
+	if err != nil {
+		name = path.Base(s.target())
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// playlistWriter 同一目录中的所有Strm对象写入同一个播放列表
+type playlistWriter struct{}
+
+func (playlistWriter) Write(s *Strm, overwrite bool) error {
+	entries, err := readPlaylist(s)
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		if v.RawURL == s.target() {
+			if !overwrite {
+				return fmt.Errorf("entry %s already exists in %s and overwrite is false", s.target(), path.Join(s.LocalDir, s.Name))
+			}
+			return nil
+		}
+	}
+	return writePlaylist(s, append(entries, &Strm{Name: s.Name, LocalDir: s.LocalDir, RawURL: s.target()}))
+}
+
+func (playlistWriter) Remove(s *Strm) error {
+	entries, err := readPlaylist(s)
+	if err != nil {
+		return err
+	}
+	rest := make([]*Strm, 0, len(entries))
+	for _, v := range entries {
+		if v.RawURL != s.target() {
+			rest = append(rest, v)
+		}
+	}
+	if len(rest) == 0 {
+		return os.RemoveAll(path.Join(s.LocalDir, s.Name))
+	}
+	return writePlaylist(s, rest)
+}
+
+// readPlaylist 读取Strm对象所在的播放列表中已有的条目，条目的RawURL为播放列表中的原始内容，文件不存在时返回空列表
+func readPlaylist(s *Strm) ([]*Strm, error) {
+	_, urls, err := readStrmFile(path.Join(s.LocalDir, s.Name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Strm, 0, len(urls))
+	for _, v := range urls {
+		entries = append(entries, &Strm{Name: s.Name, LocalDir: s.LocalDir, RawURL: v})
+	}
+	return entries, nil
+}
+
+// writePlaylist 按季和集排序后写入播放列表，无法识别集数的条目按标题排在最后
+func writePlaylist(s *Strm, entries []*Strm) error {
+	type entry struct {
+		strm  *Strm
+		title string
+		info  *MediaInfo
+	}
+	list := make([]entry, 0, len(entries))
+	for _, v := range entries {
+		e := entry{strm: v, title: v.title()}
+		dir, name, err := parseStrmURL(v.RawURL, "")
+		if err != nil {
+			dir, name = path.Split(v.RawURL)
+		}
+		if info := parseMediaInfo(path.Clean(dir), name); info != nil && info.IsEpisode() {
+			e.info = info
+		}
+		list = append(list, e)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].info, list[j].info
+		switch {
+		case a != nil && b != nil && (a.Season != b.Season || a.Episode != b.Episode):
+			if a.Season != b.Season {
+				return a.Season < b.Season
+			}
+			return a.Episode < b.Episode
+		case a != nil && b == nil:
+			return true
+		case a == nil && b != nil:
+			return false
+		}
+		return list[i].title < list[j].title
+	})
+	lines := []string{"#EXTM3U"}
+	for _, v := range list {
+		lines = append(lines, fmt.Sprintf("#EXTINF:-1,%s", v.title), v.strm.RawURL)
+	}
+	return os.WriteFile(path.Join(s.LocalDir, s.Name), []byte(strings.Join(lines, "\n")+"\n"), 0666)
+}
+
+// readStrmFile 读取strm、m3u8或m3u文件，返回文件格式和其中的链接，strm文件只读取第一个链接；链接文件返回记录的链接
+func readStrmFile(file string) (string, []string, error) {
+	if !isStrmFile(file) {
+		return readLinkFile(file)
+	}
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	format := FormatStrm
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".m3u8":
+		format = FormatM3U8
+	case ".m3u":
+		format = FormatM3U
+	}
+	urls := make([]string, 0)
+	for _, line := range strings.Split(string(byts), "\n") {
+		line = strings.TrimSpace(strings.TrimRight(line, "\r"))
+		if strings.HasPrefix(line, "#KODIPROP") && format == FormatStrm {
+			format = FormatKodi
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if format != FormatM3U && len(urls) > 1 {
+		urls = urls[:1]
+	}
+	if format != FormatM3U && len(urls) == 0 {
+		// 空文件，由解析链接时返回错误
+		urls = append(urls, "")
+	}
+	return format, urls, nil
+}
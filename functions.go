@@ -1,31 +1,39 @@
 package main
 
 import (
+	"crypto/tls"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
-	sdk "github.com/imshuai/alistsdk-go"
 	"github.com/sirupsen/logrus"
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
-	"gopkg.in/yaml.v3"
 )
 
 func checkExt(name string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
 	for _, v := range exts {
-		if strings.ToLower(filepath.Ext(name)) == v {
+		if ext == normalizeExt(v) {
 			return true
 		}
 	}
 	return false
 }
 
+// inLocalDir 判断本地路径是否为root或在root中，两者都会先清理，如去除结尾的/和./
+func inLocalDir(p, root string) bool {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(p))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func urlEncode(s string) string {
 	vv := make([]string, 0)
 	ss := strings.Split(s, "/")
@@ -39,32 +47,55 @@ func urlDecode(s string) string {
 	vv := make([]string, 0)
 	ss := strings.Split(s, "/")
 	for _, v := range ss {
-		vvv, _ := url.PathUnescape(v)
+		vvv, err := url.PathUnescape(v)
+		if err != nil {
+			// 文件名中可能包含未转义的%，解码失败时保留原样
+			vvv = v
+		}
 		vv = append(vv, vvv)
 	}
 	return strings.Join(vv, "/")
 }
 
+// writeCSV 将表头和数据写入csv文件
+func writeCSV(file string, header []string, lines [][]string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	if err := w.WriteAll(lines); err != nil {
+		return err
+	}
+	return w.Error()
+}
+
 func loadConfig(configFile string) (*Config, error) {
-	//读取config参数值，并判断传入的是json格式还是yaml格式，再分别使用对应的解析工具解析出Config结构体
-	configData, err := os.ReadFile(configFile)
+	//读取主配置文件和被包含的配置文件，支持json、yaml和toml格式，合并后解析出Config结构体
+	data, files, err := readConfigFiles(configFile)
+	if err != nil {
+		return nil, err
+	}
+	// 在解析前替换环境变量引用，数字和布尔配置项也可以使用环境变量
+	if err := interpolateEnv(data); err != nil {
+		return nil, errors.New("interpolate config file error: " + err.Error())
+	}
+	byts, err := json.Marshal(data)
 	if err != nil {
-		return nil, errors.New("read config file error: " + err.Error())
+		return nil, errors.New("marshal config error: " + err.Error())
 	}
 	config := &Config{}
-	//判断传入的是json格式还是yaml格式
-	if configFile[len(configFile)-5:] == ".json" {
-		//json格式
-		err = json.Unmarshal(configData, &config)
-		if err != nil {
-			return nil, errors.New("unmarshal json type config file error: " + err.Error())
-		}
-	} else {
-		//yaml格式
-		err = yaml.Unmarshal(configData, &config)
-		if err != nil {
-			return nil, errors.New("unmarshal yaml type config file error: " + err.Error())
-		}
+	if err := json.Unmarshal(byts, config); err != nil {
+		return nil, errors.New("unmarshal config file error: " + err.Error())
+	}
+	config.files = files
+	// 读取密钥文件
+	if err := loadSecrets(config); err != nil {
+		return nil, errors.New("load secrets error: " + err.Error())
 	}
 	return config, nil
 }
@@ -87,8 +118,8 @@ func statusBar(p *mpb.Progress) *mpb.Bar {
 	)
 }
 
-func setLogLevel() {
-	switch strings.ToLower(config.Loglevel) {
+func setLogLevel(level string) {
+	switch strings.ToLower(level) {
 	case "trace":
 		logger.SetLevel(logrus.TraceLevel)
 	case "debug":
@@ -108,21 +139,29 @@ func setLogLevel() {
 	}
 }
 
-func fetchRemoteFiles(e Endpoint) []*Strm {
-	//初始化ALIST Client
-	var client *sdk.Client
-	if e.Token != "" {
-		client = sdk.NewClientWithToken(e.BaseURL, e.Token, e.InscureTLSVerify, config.Timeout)
-	} else {
-		client = sdk.NewClient(e.BaseURL, e.Username, e.Password, e.InscureTLSVerify, config.Timeout)
-	}
-	//登录
-	u, err := client.Login()
+// newHTTPClient 根据endpoint的配置创建http客户端，timeout为超时秒数，默认跟随重定向
+func newHTTPClient(e Endpoint, timeout int) *http.Client {
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return &http.Client{
+		Timeout: time.Duration(timeout) * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: e.InscureTLSVerify},
+		},
+	}
+}
+
+// fetchRemoteFiles 获取远程文件生成的Strm对象，额外文件在独立的下载队列中下载，progress用于显示下载进度
+func fetchRemoteFiles(e Endpoint, progress *mpb.Progress) []*Strm {
+	client, err := newAlistClient(e)
 	if err != nil {
 		logger.Errorf("[MAIN]: login error: %s", err.Error())
 		return nil
 	}
-	logger.Infof("[MAIN]: %s login success, username: %s", e.BaseURL, u.Username)
+	downloader := NewDownloader(e, e.MaxDownloads, progress)
+	defer downloader.Wait()
 	strms := make([]*Strm, 0)
 	for _, dir := range e.Dirs {
 		// 设置总共需要同步的目录数量
@@ -132,10 +171,44 @@ func fetchRemoteFiles(e Endpoint) []*Strm {
 			logger.Infof("[MAIN]: dir [%s] is disabled", dir.LocalDirectory)
 			continue
 		}
+		filter, err := dir.Filter.Compile()
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] filter error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
+		mediaTypes, err := dir.MediaFileTypes()
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] media types error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
+		namer, err := dir.Naming.Compile()
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] naming error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
+		organizer, err := dir.Organize.Compile(config.organizeReport)
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] organize error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
+		output, err := dir.Output.Compile()
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] output error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
+		var nfo *NFO
+		if dir.NFO.Enabled {
+			v := dir.NFO
+			nfo = &v
+		}
 		// 遍历dir.RemoteDirectories
-		for _, remoteDir := range dir.RemoteDirectories {
+		for _, remote := range dir.RemoteDirectories {
+			remoteDir := remote.Path
+			// 按 全局 → 服务器 → 目录 → 远程目录 计算实际使用的设置
+			settings := dir.Settings(e, remote)
 			// 开始生成strm文件
 			logger.Infof("[MAIN]: fetch strm info from remote directory: %s", remoteDir)
+			logger.Debugf("[MAIN]: remote directory [%s] settings: %+v", remoteDir, settings)
 			m := &Mission{
 				// 服务器地址
 				BaseURL: e.BaseURL,
@@ -144,20 +217,44 @@ func fetchRemoteFiles(e Endpoint) []*Strm {
 				// 本地路径
 				LocalPath: dir.LocalDirectory,
 				// 扩展名
-				Exts: config.Exts,
+				Exts: settings.Exts,
 				// 额外扩展名
-				AltExts: config.AltExts,
+				AltExts: settings.AltExts,
+				// 按alist文件类型识别媒体文件
+				MediaTypes: mediaTypes,
 				// 是否创建子目录
-				IsCreateSubDirectory: config.CreateSubDirectory || dir.CreateSubDirectory,
+				IsCreateSubDirectory: settings.CreateSubDirectory,
 				// 是否递归
 				IsRecursive: !dir.NotRescursive,
 				// 是否强制刷新
-				IsForceRefresh: dir.ForceRefresh,
+				IsForceRefresh: settings.ForceRefresh,
+				// 强制刷新策略
+				Refresh: settings.Refresh,
+				// 超时时间
+				Timeout: settings.Timeout,
+				// 过滤规则
+				Filter: filter,
+				// 命名规则
+				Namer: namer,
+				// 整理规则
+				Organizer: organizer,
+				// nfo生成规则
+				NFO: nfo,
+				// 多版本和分段命名规则
+				Grouping: dir.Grouping.Compile(),
+				// 输出格式
+				Output: output,
+				// 远程根目录
+				RemoteRoot: remoteDir,
+				// 本地根目录
+				LocalRoot: dir.LocalDirectory,
 				// 客户端
-				client: client,
+				client: client.WithTimeout(settings.Timeout),
+				// 下载队列
+				downloader: downloader,
 			}
 			// 运行
-			strms = append(strms, m.GetAllStrm(e.MaxConnections)...)
+			strms = append(strms, m.GetAllStrm(settings.MaxConnections)...)
 			// 增加计数器
 			logger.Increment()
 		}
@@ -165,22 +262,27 @@ func fetchRemoteFiles(e Endpoint) []*Strm {
 	return strms
 }
 
-func fetchLocalFiles(e Endpoint) []*Strm {
-	// TODO 读取本地已有strm文件
+// fetchLocalFiles 读取本地已有strm文件，无法解析的文件不会返回，与不属于当前服务器的文件一起记录在report中，report可以为nil
+func fetchLocalFiles(e Endpoint, report *StrmReport) []*Strm {
 	strms := make([]*Strm, 0)
 	for _, dir := range e.Dirs {
 		if dir.Disabled {
 			logger.Infof("[MAIN]: dir [%s] is disabled", dir.LocalDirectory)
 			continue
 		}
+		output, err := dir.Output.Compile()
+		if err != nil {
+			logger.Errorf("[MAIN]: dir [%s] output error: %s", dir.LocalDirectory, err.Error())
+			continue
+		}
 		logger.Infof("[MAIN]: reading local directory %s", dir.LocalDirectory)
-		// 遍历路径下所有strm文件，包括子目录中
+		// 遍历路径下所有strm、m3u8、m3u文件，以及记录在数据库中的链接文件，包括子目录中
 		files := make([]string, 0)
-		err := filepath.Walk(dir.LocalDirectory, func(path string, info os.FileInfo, err error) error {
+		err = filepath.Walk(dir.LocalDirectory, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if !info.IsDir() && filepath.Ext(path) == ".strm" {
+			if !info.IsDir() && (isStrmFile(path) || output.IsLink() && getLinkRecord(path) != nil) {
 				files = append(files, path)
 			}
 			return nil
@@ -192,51 +294,70 @@ func fetchLocalFiles(e Endpoint) []*Strm {
 		}
 		logger.Infof("[MAIN]: find %d strm files", len(files))
 		for _, file := range files {
-			// 读取strm文件，返回Strm结构体
-			strm := readStrmFile(file)
-			logger.Tracef("[MAIN]: read local strm file %s, url: %s", file, strm.RawURL)
-			// 将读取的strm文件添加到strms切片中
-			strms = append(strms, strm)
+			// 读取strm文件中的链接，m3u播放列表中可能有多个
+			format, urls, err := readStrmFile(file)
+			if err != nil {
+				logger.Warnf("[MAIN]: read local strm file %s error: %s", file, err.Error())
+				report.AddUnparseable(file, "", err)
+				continue
+			}
+			for _, raw := range urls {
+				// 解析链接，返回Strm结构体，内容为本地路径时按路径映射还原为链接
+				strm, err := parseLocalStrm(file, format, output.URLOf(raw, e.BaseURL), e.BaseURL)
+				if err != nil {
+					logger.Warnf("[MAIN]: parse local strm file %s error: %s", file, err.Error())
+					report.AddUnparseable(file, raw, err)
+					continue
+				}
+				if strm.RawURL != raw {
+					strm.LocalPath = raw
+				}
+				logger.Tracef("[MAIN]: read local strm file %s, url: %s", file, strm.RawURL)
+				if strm.Foreign {
+					logger.Debugf("[MAIN]: local strm file %s not belong to %s", file, e.BaseURL)
+					report.AddForeign(file, strm.RawURL, e.BaseURL)
+				}
+				// 将读取的strm文件添加到strms切片中
+				strms = append(strms, strm)
+			}
 		}
 		time.Sleep(time.Millisecond * 200)
 	}
 	return strms
 }
 
-func readStrmFile(file string) *Strm {
-	// TODO 读取strm文件
+// parseLocalStrm 解析本地文件中的链接，返回的Strm对象总是非空，解析失败时返回错误
+func parseLocalStrm(file, format, raw, baseURL string) (*Strm, error) {
 	strm := &Strm{}
 	strm.Name = filepath.Base(file)
 	strm.LocalDir = filepath.Dir(file)
-	strm.RawURL = func() string {
-		byts, err := os.ReadFile(file)
-		if err != nil {
-			return ""
-		}
-		//返回的字符串应该有且只有一行，且不会以\n或者\r\n结束
-		return strings.TrimRight(strings.Split(string(byts), "\n")[0], "\r")
-	}()
-	strm.RemoteDir = func() string {
-		logger.Tracef("[MAIN]: parse remote directory from strm: %s url: %s", file, strm.RawURL)
-		paths := strings.Split(strings.Split(strm.RawURL, "/d/")[1], "/")
-		paths = paths[:len(paths)-1]
-		str := urlDecode("/" + strings.Join(paths, "/"))
-		logger.Debugf("[MAIN]: remote directory: %s", str)
-		return str
-	}()
-	return strm
+	strm.RawURL = raw
+	if format != FormatStrm {
+		strm.Format = format
+	}
+	logger.Tracef("[MAIN]: parse remote directory from strm: %s url: %s", file, strm.RawURL)
+	var err error
+	strm.RemoteDir, _, err = parseStrmURL(strm.RawURL, baseURL)
+	if err != nil {
+		return strm, err
+	}
+	base := strings.TrimRight(baseURL, "/")
+	strm.Foreign = base != "" && !strings.HasPrefix(strm.RawURL, base+"/")
+	logger.Debugf("[MAIN]: remote directory: %s", strm.RemoteDir)
+	return strm, nil
 }
 
 func PrintDebugInfo() {
 	//输出配置文件调试信息
 	for _, endpoint := range config.Endpoints {
 		logger.Debugf("[MAIN]: base url: %s", endpoint.BaseURL)
-		logger.Debugf("[MAIN]: token: %s", endpoint.Token)
+		logger.Debugf("[MAIN]: token: %s", redacted(endpoint.Token))
 		logger.Debugf("[MAIN]: username: %s", endpoint.Username)
-		logger.Debugf("[MAIN]: password: %s", endpoint.Password)
+		logger.Debugf("[MAIN]: password: %s", redacted(endpoint.Password))
 		logger.Debugf("[MAIN]: inscure tls verify: %t", endpoint.InscureTLSVerify)
 		logger.Debugf("[MAIN]: dirs: %+v", endpoint.Dirs)
 		logger.Debugf("[MAIN]: max connections: %d", endpoint.MaxConnections)
+		logger.Debugf("[MAIN]: max downloads: %d", endpoint.MaxDownloads)
 	}
 	logger.Debugf("[MAIN]: timeout: %d", config.Timeout)
 	logger.Debugf("[MAIN]: create sub directory: %t", config.CreateSubDirectory)
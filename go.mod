@@ -2,7 +2,12 @@ module AlistAutoStrm
 
 go 1.20
 
-require github.com/urfave/cli/v2 v2.27.5
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/urfave/cli/v2 v2.27.5
+	golang.org/x/term v0.25.0
+)
 
 require (
 	github.com/VividCortex/ewma v1.2.0 // indirect
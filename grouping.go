@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Grouping 同一目录中多版本和分段媒体文件的命名规则，按 Emby/Jellyfin 的约定命名
+//
+//	多版本: Movie - 2160p.strm、Movie - 1080p.strm
+//	分段:   Movie-part1.strm、Movie-part2.strm
+type Grouping struct {
+	Versions bool `json:"versions" yaml:"versions"`
+	Parts    bool `json:"parts" yaml:"parts"`
+}
+
+// 文件名中的分段标记，如 CD1、Part 2、Disc.1、(pt3)
+var partPattern = regexp.MustCompile(`(?i)[\s._-]*[\[(]?\b(?:cd|dvd|part|pt|disc|disk)[\s._-]?(\d{1,2})[\])]?(?:$|[\s._-])`)
+
+// groupItem 一个媒体文件及其生成的strm
+type groupItem struct {
+	strm *Strm
+	name string // 远程文件名
+}
+
+// Compile 未启用任何规则时返回nil
+func (g Grouping) Compile() *Grouping {
+	if !g.Versions && !g.Parts {
+		return nil
+	}
+	return &g
+}
+
+// splitPart 去除文件名中的分段标记，返回去除后的名称和分段序号，没有分段标记时序号为0
+func splitPart(name string) (string, int) {
+	matches := partPattern.FindAllStringSubmatchIndex(name, -1)
+	if len(matches) == 0 {
+		return name, 0
+	}
+	loc := matches[len(matches)-1]
+	n, _ := strconv.Atoi(name[loc[2]:loc[3]])
+	rest := strings.Trim(name[loc[1]:], " ._-")
+	name = strings.Trim(name[:loc[0]], " ._-")
+	if rest != "" {
+		name += " " + rest
+	}
+	return name, n
+}
+
+// Group 重命名同一目录中属于同一媒体的多个版本或分段的strm文件，items为同一远程目录中的媒体文件
+func (g *Grouping) Group(items []groupItem) {
+	if g == nil || len(items) < 2 {
+		return
+	}
+	grouped := make(map[*Strm]bool)
+	if g.Parts {
+		for _, group := range groupItems(items, grouped, func(name string) string {
+			name, n := splitPart(name)
+			if n == 0 {
+				return ""
+			}
+			return name
+		}) {
+			g.nameParts(group, grouped)
+		}
+	}
+	if g.Versions {
+		for _, group := range groupItems(items, grouped, func(name string) string {
+			title, _ := splitJunk(name)
+			return title
+		}) {
+			g.nameVersions(group, grouped)
+		}
+	}
+}
+
+// groupItems 按本地目录和key分组，忽略已分组和key为空的项目，只返回包含多个项目的分组
+func groupItems(items []groupItem, grouped map[*Strm]bool, key func(name string) string) [][]groupItem {
+	groups := make(map[string][]groupItem)
+	keys := make([]string, 0)
+	for _, item := range items {
+		if grouped[item.strm] {
+			continue
+		}
+		k := key(strings.TrimSuffix(item.name, filepath.Ext(item.name)))
+		if k == "" {
+			continue
+		}
+		k = item.strm.LocalDir + "/" + normalizeName(k+filepath.Ext(item.name))
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], item)
+	}
+	res := make([][]groupItem, 0)
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			res = append(res, groups[k])
+		}
+	}
+	return res
+}
+
+// nameParts 按分段序号命名，序号重复时认为不是同一媒体的分段
+func (g *Grouping) nameParts(group []groupItem, grouped map[*Strm]bool) {
+	parts := make(map[int]bool)
+	for _, item := range group {
+		_, n := splitPart(strings.TrimSuffix(item.name, filepath.Ext(item.name)))
+		if parts[n] {
+			logger.Debugf("[MAIN]: duplicate part %d in [%s], skip grouping", n, item.strm.RemoteDir)
+			return
+		}
+		parts[n] = true
+	}
+	for _, item := range group {
+		_, n := splitPart(strings.TrimSuffix(item.name, filepath.Ext(item.name)))
+		base, _ := splitPart(strings.TrimSuffix(item.strm.Name, filepath.Ext(item.strm.Name)))
+		item.strm.Name = fmt.Sprintf("%s-part%d.strm", base, n)
+		grouped[item.strm] = true
+	}
+}
+
+// nameVersions 以分辨率、编码等信息作为版本名称命名，没有版本信息的文件使用标题作为文件名
+func (g *Grouping) nameVersions(group []groupItem, grouped map[*Strm]bool) {
+	// 按远程文件名排序，保证重复版本名称的序号稳定
+	sort.Slice(group, func(i, j int) bool { return group[i].name < group[j].name })
+	labels := make(map[string]int)
+	for _, item := range group {
+		_, label := splitJunk(strings.TrimSuffix(item.name, filepath.Ext(item.name)))
+		base, _ := splitJunk(strings.TrimSuffix(item.strm.Name, filepath.Ext(item.strm.Name)))
+		labels[label]++
+		if n := labels[label]; n > 1 {
+			label = strings.TrimSpace(fmt.Sprintf("%s %d", label, n))
+		}
+		if label == "" {
+			item.strm.Name = base + ".strm"
+		} else {
+			item.strm.Name = fmt.Sprintf("%s - %s.strm", base, label)
+		}
+		grouped[item.strm] = true
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestSplitPart(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		part int
+	}{
+		{"Movie CD1", "Movie", 1},
+		{"Movie.Part.2.1080p", "Movie 1080p", 2},
+		{"Movie-pt3", "Movie", 3},
+		{"Movie (Disc 1)", "Movie", 1},
+		{"Movie [DVD2]", "Movie", 2},
+		{"Movie.2010.cd2", "Movie.2010", 2},
+		{"Departure", "Departure", 0},
+		{"Movie 2", "Movie 2", 0},
+		{"Apart 1", "Apart 1", 0},
+	}
+	for _, tt := range tests {
+		base, part := splitPart(tt.name)
+		if base != tt.base || part != tt.part {
+			t.Errorf("splitPart(%q) = %q, %d, want %q, %d", tt.name, base, part, tt.base, tt.part)
+		}
+	}
+}
+
+func TestSidecarPathAfterGrouping(t *testing.T) {
+	names := []string{"Movie.1080p.mkv", "Movie.2160p.mkv"}
+	items := make([]groupItem, 0, len(names))
+	for _, name := range names {
+		items = append(items, groupItem{strm: &Strm{Name: name[:len(name)-4] + ".strm", LocalDir: "media/Movie"}, name: name})
+	}
+	(&Grouping{Versions: true}).Group(items)
+	medias := mediasOf(items)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Movie.2160p.chs.srt", "media/Movie/Movie - 2160p.chs.srt"},
+		{"Movie.1080p.nfo", "media/Movie/Movie - 1080p.nfo"},
+		{"Movie.2160p.poster.jpg", "media/Movie/Movie - 2160p.poster.jpg"},
+		{"folder.jpg", "media/Movie/folder.jpg"},
+	}
+	for _, tt := range tests {
+		if got := sidecarPath(tt.name, medias, "media"); got != tt.want {
+			t.Errorf("sidecarPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/term"
+)
+
+// init 命令生成的配置的默认值
+var (
+	initExts    = []string{".mp4", ".mkv", ".avi", ".rmvb", ".ts", ".iso"}
+	initAltExts = []string{".jpg", ".nfo", ".srt", ".ass"}
+)
+
+// prompter 读取用户在终端中的输入
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// ask 提示用户输入，直接回车时返回默认值
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// confirm 提示用户确认，接受 y/n
+func (p *prompter) confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(question+" ("+hint+")", "")
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(answer) {
+	case "":
+		return def, nil
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// secret 提示用户输入密码，终端中不回显输入内容
+func (p *prompter) secret(question string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return p.ask(question, "")
+	}
+	fmt.Fprintf(p.out, "%s: ", question)
+	byts, err := term.ReadPassword(fd)
+	fmt.Fprintln(p.out)
+	return strings.TrimSpace(string(byts)), err
+}
+
+// askEndpoint 询问服务器地址和登录方式，登录成功后返回服务器配置和客户端
+func (p *prompter) askEndpoint() (*Endpoint, *AlistClient, error) {
+	e := &Endpoint{MaxConnections: defaultMaxConnections, MaxDownloads: 2}
+	for {
+		baseURL, err := p.ask("Alist base url", "http://127.0.0.1:5244")
+		if err != nil {
+			return nil, nil, err
+		}
+		if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(p.out, "invalid base url %q, must be like https://alist.example.com\n", baseURL)
+			continue
+		}
+		e.BaseURL = strings.TrimRight(baseURL, "/")
+		break
+	}
+	insecure, err := p.confirm("Skip TLS certificate verification", false)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.InscureTLSVerify = insecure
+	for {
+		method, err := p.ask("Login with password, token or guest", "password")
+		if err != nil {
+			return nil, nil, err
+		}
+		e.Token, e.Username, e.Password = "", "", ""
+		switch strings.ToLower(method) {
+		case "password":
+			if e.Username, err = p.ask("Username", "admin"); err != nil {
+				return nil, nil, err
+			}
+			if e.Password, err = p.secret("Password"); err != nil {
+				return nil, nil, err
+			}
+		case "token":
+			if e.Token, err = p.secret("Token"); err != nil {
+				return nil, nil, err
+			}
+		case "guest":
+		default:
+			fmt.Fprintf(p.out, "unknown login method %q\n", method)
+			continue
+		}
+		client, err := newAlistClient(*e)
+		if err == nil {
+			return e, client, nil
+		}
+		fmt.Fprintf(p.out, "login %s error: %s\n", e.BaseURL, err.Error())
+		retry, err := p.confirm("Try again", true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !retry {
+			return nil, nil, errors.New("login failed")
+		}
+	}
+}
+
+// browse 交互式浏览远程目录，返回用户选择的目录
+func (p *prompter) browse(client *AlistClient) ([]string, error) {
+	selected := make([]string, 0)
+	current := "/"
+	for {
+		files, err := client.List(current, "", 1, 0, false)
+		if err != nil {
+			// 根目录无法列出时返回上一级也没有用，直接返回错误
+			if current == "/" {
+				return nil, fmt.Errorf("list / error: %s", err.Error())
+			}
+			fmt.Fprintf(p.out, "list %s error: %s\n", current, err.Error())
+			current = path.Dir(current)
+			continue
+		}
+		dirs := make([]string, 0)
+		for _, f := range files {
+			if f.IsDir {
+				dirs = append(dirs, f.Name)
+			}
+		}
+		sort.Strings(dirs)
+		fmt.Fprintf(p.out, "\n%s\n", current)
+		for i, d := range dirs {
+			fmt.Fprintf(p.out, "  [%d] %s/\n", i+1, d)
+		}
+		if len(selected) > 0 {
+			fmt.Fprintf(p.out, "selected: %s\n", strings.Join(selected, ", "))
+		}
+		answer, err := p.ask("Number to enter, a to add current directory, .. to go up, d when done", "")
+		if err != nil {
+			return nil, err
+		}
+		switch answer {
+		case "..":
+			current = path.Dir(current)
+		case "a":
+			if !contains(selected, current) {
+				selected = append(selected, current)
+			}
+		case "d":
+			if len(selected) == 0 {
+				fmt.Fprintln(p.out, "no directory selected")
+				continue
+			}
+			return selected, nil
+		default:
+			i, err := strconv.Atoi(answer)
+			if err != nil || i < 1 || i > len(dirs) {
+				fmt.Fprintf(p.out, "invalid choice %q\n", answer)
+				continue
+			}
+			current = path.Join(current, dirs[i-1])
+		}
+	}
+}
+
+// contains 判断字符串是否在列表中
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// askDirs 为选择的远程目录设置本地目录，本地目录相同的远程目录合并到同一个dir中
+func (p *prompter) askDirs(remotes []string) ([]Dir, error) {
+	root, err := p.ask("Local root directory for strm files", "data")
+	if err != nil {
+		return nil, err
+	}
+	dirs := make([]Dir, 0, len(remotes))
+	createSubDirectory := true
+	index := make(map[string]int)
+	for _, remote := range remotes {
+		suggest := root
+		if remote != "/" {
+			suggest = filepath.Join(root, path.Base(remote))
+		}
+		local, err := p.ask("Local directory for "+remote, suggest)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := index[local]; ok {
+			dirs[i].RemoteDirectories = append(dirs[i].RemoteDirectories, RemoteDirectory{Path: remote})
+			continue
+		}
+		index[local] = len(dirs)
+		d := Dir{LocalDirectory: local, RemoteDirectories: []RemoteDirectory{{Path: remote}}}
+		d.CreateSubDirectory = &createSubDirectory
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// boolValue 返回布尔指针的值，未设置时为false
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+// quote 返回带引号的字符串，同时适用于JSON和YAML
+func quote(s string) string {
+	byts, _ := json.Marshal(s)
+	return string(byts)
+}
+
+// quoteList 返回带引号的字符串列表
+func quoteList(list []string) string {
+	items := make([]string, 0, len(list))
+	for _, v := range list {
+		items = append(items, quote(v))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// initYAML 生成带注释的YAML配置文件
+func initYAML(c *Config) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# generated by %s init, see README for all options\n", NAME)
+	fmt.Fprintf(b, "# database file to store strm records\n")
+	fmt.Fprintf(b, "database: %s\n", quote(c.Database))
+	fmt.Fprintf(b, "# trace, debug, info, warn, error\n")
+	fmt.Fprintf(b, "loglevel: %s\n", quote(c.Loglevel))
+	fmt.Fprintf(b, "# request timeout in seconds\n")
+	fmt.Fprintf(b, "timeout: %d\n", c.Timeout)
+	fmt.Fprintf(b, "# extensions of media files to generate strm files\n")
+	fmt.Fprintf(b, "exts: %s\n", quoteList(c.Exts))
+	fmt.Fprintf(b, "# extensions of files to download next to strm files, e.g. posters and subtitles\n")
+	fmt.Fprintf(b, "alt-exts: %s\n", quoteList(c.AltExts))
+	fmt.Fprintf(b, "endpoints:\n")
+	for _, e := range c.Endpoints {
+		fmt.Fprintf(b, "  - base-url: %s\n", quote(e.BaseURL))
+		switch {
+		case e.Token != "":
+			fmt.Fprintf(b, "    # token can also be read from environment ${ALIST_TOKEN} or token-file\n")
+			fmt.Fprintf(b, "    token: %s\n", quote(e.Token))
+		case e.Username != "":
+			fmt.Fprintf(b, "    username: %s\n", quote(e.Username))
+			fmt.Fprintf(b, "    # password can also be read from environment ${ALIST_PASSWORD} or password-file\n")
+			fmt.Fprintf(b, "    password: %s\n", quote(e.Password))
+		default:
+			fmt.Fprintf(b, "    # no token or username, access alist as guest\n")
+		}
+		fmt.Fprintf(b, "    inscure-tls-verify: %t\n", e.InscureTLSVerify)
+		fmt.Fprintf(b, "    # concurrent requests to alist\n")
+		fmt.Fprintf(b, "    max-connections: %d\n", e.MaxConnections)
+		fmt.Fprintf(b, "    # concurrent downloads of alt-exts files\n")
+		fmt.Fprintf(b, "    max-downloads: %d\n", e.MaxDownloads)
+		fmt.Fprintf(b, "    dirs:\n")
+		for _, d := range e.Dirs {
+			fmt.Fprintf(b, "      - local-directory: %s\n", quote(d.LocalDirectory))
+			fmt.Fprintf(b, "        remote-directories:\n")
+			for _, r := range d.RemoteDirectories {
+				fmt.Fprintf(b, "          - %s\n", quote(r.Path))
+			}
+			fmt.Fprintf(b, "        # keep remote sub directories in local directory\n")
+			fmt.Fprintf(b, "        create-sub-directory: %t\n", boolValue(d.CreateSubDirectory))
+			fmt.Fprintf(b, "        not-recursive: %t\n", d.NotRescursive)
+			fmt.Fprintf(b, "        force-refresh: %t\n", boolValue(d.ForceRefresh))
+			fmt.Fprintf(b, "        disabled: %t\n", d.Disabled)
+		}
+	}
+	return b.String()
+}
+
+// initDir init 命令生成的目录配置
+type initDir struct {
+	LocalDirectory     string   `json:"local-directory" toml:"local-directory"`
+	RemoteDirectories  []string `json:"remote-directories" toml:"remote-directories"`
+	CreateSubDirectory bool     `json:"create-sub-directory" toml:"create-sub-directory"`
+	NotRescursive      bool     `json:"not-recursive" toml:"not-recursive"`
+	ForceRefresh       bool     `json:"force-refresh" toml:"force-refresh"`
+	Disabled           bool     `json:"disabled" toml:"disabled"`
+}
+
+// initEndpoint init 命令生成的服务器配置
+type initEndpoint struct {
+	BaseURL          string    `json:"base-url" toml:"base-url"`
+	Token            string    `json:"token,omitempty" toml:"token,omitempty"`
+	Username         string    `json:"username,omitempty" toml:"username,omitempty"`
+	Password         string    `json:"password,omitempty" toml:"password,omitempty"`
+	InscureTLSVerify bool      `json:"inscure-tls-verify" toml:"inscure-tls-verify"`
+	MaxConnections   int       `json:"max-connections" toml:"max-connections"`
+	MaxDownloads     int       `json:"max-downloads" toml:"max-downloads"`
+	Dirs             []initDir `json:"dirs" toml:"dirs"`
+}
+
+// initData init 命令生成的配置，JSON和TOML不支持注释或难以手写注释，只包含基本配置项
+type initData struct {
+	Database  string         `json:"database" toml:"database"`
+	Loglevel  string         `json:"loglevel" toml:"loglevel"`
+	Timeout   int            `json:"timeout" toml:"timeout"`
+	Exts      []string       `json:"exts" toml:"exts"`
+	AltExts   []string       `json:"alt-exts" toml:"alt-exts"`
+	Endpoints []initEndpoint `json:"endpoints" toml:"endpoints"`
+}
+
+func newInitData(c *Config) *initData {
+	out := &initData{Database: c.Database, Loglevel: c.Loglevel, Timeout: c.Timeout, Exts: c.Exts, AltExts: c.AltExts}
+	for _, e := range c.Endpoints {
+		v := initEndpoint{BaseURL: e.BaseURL, Token: e.Token, Username: e.Username, Password: e.Password, InscureTLSVerify: e.InscureTLSVerify, MaxConnections: e.MaxConnections, MaxDownloads: e.MaxDownloads}
+		for _, d := range e.Dirs {
+			v.Dirs = append(v.Dirs, initDir{LocalDirectory: d.LocalDirectory, RemoteDirectories: remotePaths(d.RemoteDirectories), CreateSubDirectory: boolValue(d.CreateSubDirectory), NotRescursive: d.NotRescursive, ForceRefresh: boolValue(d.ForceRefresh), Disabled: d.Disabled})
+		}
+		out.Endpoints = append(out.Endpoints, v)
+	}
+	return out
+}
+
+// initJSON 生成JSON配置文件
+func initJSON(c *Config) (string, error) {
+	byts, err := json.MarshalIndent(newInitData(c), "", "  ")
+	return string(byts) + "\n", err
+}
+
+// initTOML 生成TOML配置文件
+func initTOML(c *Config) (string, error) {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# generated by %s init, see README for all options\n", NAME)
+	if err := toml.NewEncoder(b).Encode(newInitData(c)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// initConfig 交互式生成配置文件
+func initConfig(file string) error {
+	p := newPrompter()
+	if _, err := os.Stat(file); err == nil {
+		overwrite, err := p.confirm(fmt.Sprintf("Config file %s already exists, overwrite", file), false)
+		if err != nil || !overwrite {
+			return err
+		}
+	}
+	c := &Config{
+		Database: "strm.db",
+		Loglevel: "info",
+		Timeout:  defaultTimeout,
+		Exts:     initExts,
+		AltExts:  initAltExts,
+	}
+	// 登录和浏览目录时使用默认的超时时间
+	config = c
+	for {
+		e, client, err := p.askEndpoint()
+		if err != nil {
+			return err
+		}
+		remotes, err := p.browse(client)
+		if err != nil {
+			return err
+		}
+		if e.Dirs, err = p.askDirs(remotes); err != nil {
+			return err
+		}
+		c.Endpoints = append(c.Endpoints, *e)
+		more, err := p.confirm("Add another alist server", false)
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+	database, err := p.ask("Database file", c.Database)
+	if err != nil {
+		return err
+	}
+	c.Database = database
+	for _, problem := range c.Validate() {
+		fmt.Fprintf(p.out, "config %s\n", problem)
+	}
+	content := initYAML(c)
+	switch configFormat(file, nil) {
+	case "json":
+		content, err = initJSON(c)
+	case "toml":
+		content, err = initTOML(c)
+	}
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(file); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	// 配置文件中包含密码或token
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "config file %s written, run update-database and then update to generate strm files\n", file)
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAlist 模拟alist的fs/list接口，tree中没有的目录返回错误
+func newTestAlist(t *testing.T, tree map[string][]string) *AlistClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Path string `json:"path"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		dirs, ok := tree[body.Path]
+		if !ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 500, "message": "object not found"})
+			return
+		}
+		content := make([]map[string]interface{}, 0, len(dirs))
+		for _, d := range dirs {
+			content = append(content, map[string]interface{}{"name": d, "is_dir": true})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "message": "success", "data": map[string]interface{}{"content": content, "total": len(content)}})
+	}))
+	t.Cleanup(srv.Close)
+	e := Endpoint{BaseURL: srv.URL, Token: "token"}
+	return &AlistClient{endpoint: e, auth: &alistAuth{token: "token"}, timeout: 5, http: newHTTPClient(e, 5)}
+}
+
+func TestBrowse(t *testing.T) {
+	client := newTestAlist(t, map[string][]string{
+		"/":       {"movies", "broken"},
+		"/movies": {},
+	})
+	// 进入broken失败后回到根目录，再进入movies并选择
+	p := &prompter{in: bufio.NewReader(strings.NewReader("1\n2\na\nd\n")), out: io.Discard}
+	selected, err := p.browse(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, []string{"/movies"}) {
+		t.Errorf("browse() = %v, want [/movies]", selected)
+	}
+}
+
+func TestBrowseRootError(t *testing.T) {
+	client := newTestAlist(t, map[string][]string{})
+	p := &prompter{in: bufio.NewReader(strings.NewReader("")), out: io.Discard}
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.browse(client)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("browse() error = nil, want list error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("browse() loops when the root can not be listed")
+	}
+}
+
+func TestAskEndpointGuest(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	config = &Config{Timeout: 5}
+	// 只允许游客访问，登录或携带token的请求都返回错误
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/fs/list" || r.Header.Get("Authorization") != "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": 400, "message": "guest only"})
+			return
+		}
+		content := []map[string]interface{}{{"name": "public", "is_dir": true}}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 200, "message": "success", "data": map[string]interface{}{"content": content, "total": 1}})
+	}))
+	defer srv.Close()
+
+	p := &prompter{in: bufio.NewReader(strings.NewReader(srv.URL + "/\n\nguest\n1\na\nd\n")), out: io.Discard}
+	e, client, err := p.askEndpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Token != "" || e.Username != "" || e.BaseURL != srv.URL {
+		t.Errorf("askEndpoint() = %+v, want guest endpoint of %s", e, srv.URL)
+	}
+	selected, err := p.browse(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, []string{"/public"}) {
+		t.Errorf("browse() = %v, want [/public]", selected)
+	}
+}
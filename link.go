@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// 输出模式
+const (
+	ModeURL      = "url"      // 写入alist链接
+	ModeLocal    = "local"    // 写入映射后的本地路径
+	ModeSymlink  = "symlink"  // 创建指向本地路径的符号链接
+	ModeHardlink = "hardlink" // 创建指向本地路径的硬链接，需要与本地挂载目录在同一文件系统
+)
+
+// compileMode 检查输出模式和路径映射
+func (o *Output) compileMode() error {
+	o.Mode = strings.ToLower(strings.TrimSpace(o.Mode))
+	switch o.Mode {
+	case "":
+		o.Mode = ModeURL
+	case ModeURL, ModeLocal, ModeSymlink, ModeHardlink:
+	default:
+		return fmt.Errorf("unknown output mode %q, support: url, local, symlink, hardlink", o.Mode)
+	}
+	if o.Mode == ModeURL {
+		return nil
+	}
+	if o.IsLink() && o.Format != FormatStrm {
+		return fmt.Errorf("output format %q can not be used with mode %q", o.Format, o.Mode)
+	}
+	if len(o.PathMapping) == 0 {
+		return fmt.Errorf("output mode %q requires path-mapping", o.Mode)
+	}
+	mapping := make(map[string]string, len(o.PathMapping))
+	for remote, local := range o.PathMapping {
+		if !path.IsAbs(remote) || local == "" {
+			return fmt.Errorf("invalid path-mapping %q: %q, remote path must be absolute", remote, local)
+		}
+		mapping[path.Clean(remote)] = filepath.Clean(local)
+	}
+	o.PathMapping = mapping
+	return nil
+}
+
+// IsLink 判断是否为符号链接或硬链接模式
+func (o *Output) IsLink() bool {
+	return o != nil && (o.Mode == ModeSymlink || o.Mode == ModeHardlink)
+}
+
+// localPathOf 按最长前缀将远程路径映射为本地路径
+func (o *Output) localPathOf(remotePath string) (string, error) {
+	var matched string
+	for remote := range o.PathMapping {
+		if (remote == "/" || remotePath == remote || strings.HasPrefix(remotePath, remote+"/")) && len(remote) > len(matched) {
+			matched = remote
+		}
+	}
+	if matched == "" {
+		return "", fmt.Errorf("no path-mapping for remote file [%s]", remotePath)
+	}
+	return filepath.Join(o.PathMapping[matched], filepath.FromSlash(strings.TrimPrefix(remotePath, matched))), nil
+}
+
+// URLOf 将本地文件中的内容还原为alist链接，内容为本地路径时按路径映射反向查找，找不到时原样返回
+func (o *Output) URLOf(content, baseURL string) string {
+	lower := strings.ToLower(content)
+	if o == nil || o.Mode == ModeURL || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return content
+	}
+	var matched string
+	for remote, local := range o.PathMapping {
+		if (content == local || strings.HasPrefix(content, local+string(filepath.Separator))) && len(local) > len(o.PathMapping[matched]) {
+			matched = remote
+		}
+	}
+	if matched == "" {
+		return content
+	}
+	rel := filepath.ToSlash(strings.TrimPrefix(content, o.PathMapping[matched]))
+	return strings.TrimRight(baseURL, "/") + "/d" + path.Join(matched, rel)
+}
+
+// LinkRecord 记录一个链接文件对应的远程文件
+type LinkRecord struct {
+	RawURL string `json:"raw_url"`
+	Mode   string `json:"mode"`
+	Target string `json:"target"`
+}
+
+// getLinkRecord 根据本地路径获取链接记录，不存在时返回nil
+func getLinkRecord(localPath string) *LinkRecord {
+	var record *LinkRecord
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("link"))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(filepath.Clean(localPath)))
+		if v == nil {
+			return nil
+		}
+		record = &LinkRecord{}
+		return json.Unmarshal(v, record)
+	})
+	return record
+}
+
+// readLinkFile 读取链接文件对应的远程链接，没有记录的文件返回错误
+func readLinkFile(file string) (string, []string, error) {
+	record := getLinkRecord(file)
+	if record == nil {
+		return "", nil, fmt.Errorf("%s is not a strm or link file", file)
+	}
+	return record.Mode, []string{record.RawURL}, nil
+}
+
+// linkWriter 创建指向本地路径的符号链接或硬链接，并记录在数据库中
+type linkWriter struct {
+	hard bool
+}
+
+func (w linkWriter) Write(s *Strm, overwrite bool) error {
+	if s.LocalPath == "" {
+		return fmt.Errorf("no local path for %s", s.RawURL)
+	}
+	file := path.Join(s.LocalDir, s.Name)
+	if _, err := os.Lstat(file); err == nil {
+		if !overwrite {
+			return fmt.Errorf("file %s already exists and overwrite is false", file)
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	record := &LinkRecord{RawURL: s.RawURL, Mode: ModeSymlink, Target: s.LocalPath}
+	var err error
+	if w.hard {
+		record.Mode = ModeHardlink
+		err = os.Link(s.LocalPath, file)
+	} else {
+		err = os.Symlink(s.LocalPath, file)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("link"))
+		if err != nil {
+			return err
+		}
+		byts, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(filepath.Clean(file)), byts)
+	})
+}
+
+func (linkWriter) Remove(s *Strm) error {
+	file := path.Join(s.LocalDir, s.Name)
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("link"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(filepath.Clean(file)))
+	})
+}
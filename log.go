@@ -109,12 +109,15 @@ func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
 	// Get the timestamp of the log entry in the format "2006-01-02 15:04:05".
 	timestamp := entry.Time.Format("2006-01-02 15:04:05")
 
+	// Hide tokens and passwords in the message.
+	message := redactSecrets(entry.Message)
+
 	// Format the log entry into the buffer.
 	// The format is "[timestamp] [log level] log message\n".
 	if f.Colored {
-		buffer.WriteString(fmt.Sprintf("[%s] [%s%s%s] %s\n", timestamp, colors[entry.Level.String()], entry.Level.String(), colors["end"], entry.Message))
+		buffer.WriteString(fmt.Sprintf("[%s] [%s%s%s] %s\n", timestamp, colors[entry.Level.String()], entry.Level.String(), colors["end"], message))
 	} else {
-		buffer.WriteString(fmt.Sprintf("[%s] [%s] %s\n", timestamp, entry.Level.String(), entry.Message))
+		buffer.WriteString(fmt.Sprintf("[%s] [%s] %s\n", timestamp, entry.Level.String(), message))
 	}
 	// Return the formatted log entry as a byte array and a nil error.
 	return buffer.Bytes(), nil
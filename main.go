@@ -59,12 +59,27 @@ func main() {
 				if c.Command.Name == "version" {
 					return nil
 				}
+				// config 命令自行读取和检查配置文件，init 命令生成配置文件
+				if c.Args().First() == "config" || c.Args().First() == "init" {
+					return nil
+				}
 				var err error
 				config, err = loadConfig(path)
 				if err != nil {
 					logger.Errorf("[MAIN]: load config error: %s", err.Error())
 					return err
 				}
+				problems := config.Validate()
+				for _, p := range problems {
+					if p.Warning {
+						logger.Warnf("[MAIN]: config %s", p)
+					} else {
+						logger.Errorf("[MAIN]: config %s", p)
+					}
+				}
+				if n := configErrors(problems); n > 0 {
+					return fmt.Errorf("config file %s has %d errors, run config check for details", path, n)
+				}
 				if config.ColoredLog {
 					logger.SetFormatter(&Formatter{
 						Colored: true,
@@ -87,7 +102,7 @@ func main() {
 				}
 				logger.Info("[MAIN]: read config file success")
 				logger.Infof("[MAIN]: set log level: %s", config.Loglevel)
-				setLogLevel()
+				setLogLevel(config.Loglevel)
 				return nil
 			},
 		},
@@ -96,7 +111,7 @@ func main() {
 		{
 			Name:  "update",
 			Usage: "update strm file with choosed mode",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:  "mode",
 					Usage: "update mode, support: local, remote. when strm content is same but filename changed, local: keep local filename, remote: rename local filename to remote filename",
@@ -107,125 +122,82 @@ func main() {
 					Usage: "when this flag is set, will not use incremental update, will update all files",
 					Value: false,
 				},
-			},
+				&cli.BoolFlag{
+					Name:  "delete-foreign",
+					Usage: "in remote mode, also delete local strm files which not point to the endpoint",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:  "report",
+					Usage: "write unparseable and foreign local strm files to csv `FILE`",
+				},
+				&cli.StringFlag{
+					Name:  "organize-report",
+					Usage: "write remote files which can not be organized to csv `FILE`",
+				},
+				&cli.DurationFlag{
+					Name:  "interval",
+					Usage: "keep running and update every `DURATION` (e.g. 6h), reload config file when it changes or on SIGHUP. 0 means run once",
+				},
+			}, selectorFlags()...),
 			Action: func(c *cli.Context) error {
-				var err error
-				bar := statusBar(p)
-				logger.SetBar(bar)
-
-				PrintDebugInfo()
-
-				mode := c.String("mode")
-				logger.Debugf("[MAIN]: update mode: %s", mode)
-				config.isIncrementalUpdate = !c.Bool("no-incremental-update")
-				logger.Debugf("[MAIN]: incremental update: %t", config.isIncrementalUpdate)
-				config.records, err = GetRecordCollection()
-				if err != nil {
-					err := errors.New("get record collection error: " + err.Error())
-					logger.Errorf("[MAIN]: %s", err.Error())
-					return err
-				}
-				localStrms := make(map[string]*Strm, 0)
-				remoteStrms := make(map[string]*Strm, 0)
-				addStrms := make([]*Strm, 0)
-				deleteStrms := make([]*Strm, 0)
-				ignored, added, deleted := 0, 0, 0
-				switch mode {
-				case "local":
-					for _, e := range config.Endpoints {
-						localData := fetchLocalFiles(e)
-						logger.Infof("[MAIN]: fetched %d local files", len(localData))
-						for _, v := range localData {
-							localStrms[v.Key()] = v
-						}
-						remoteData := fetchRemoteFiles(e)
-						logger.Infof("[MAIN]: fetched %d remote files", len(remoteData))
-						for _, v := range remoteData {
-							if _, ok := localStrms[v.Key()]; !ok {
-								addStrms = append(addStrms, v)
-								logger.Debugf("[MAIN]: %s 已加入待保存列表", v.Name)
-								logger.Tracef("[MAIN]: raw_url: %s", v.RawURL)
-							} else {
-								ignored++
-								logger.Debugf("[MAIN]: %s already exits, ignored.", v.Name)
-								logger.Tracef("[MAIN]: local content: %s", localStrms[v.Key()].RawURL)
-								logger.Tracef("[MAIN]: remote content: %s", v.RawURL)
-							}
-						}
-					}
-				case "remote":
-					for _, e := range config.Endpoints {
-						for _, v := range fetchRemoteFiles(e) {
-							remoteStrms[v.Key()] = v
-						}
-						for _, v := range fetchLocalFiles(e) {
-							if _, ok := remoteStrms[v.Key()]; !ok {
-								deleteStrms = append(deleteStrms, v)
-							} else {
-								ignored++
-								logger.Infof("[MAIN]: %s already exits, ignored.", v.Name)
-								logger.Tracef("[MAIN]: local content: %s", localStrms[v.Key()].RawURL)
-								logger.Tracef("[MAIN]: remote content: %s", v.RawURL)
-							}
-						}
-					}
-				default:
-					err := fmt.Errorf("invalid update mode: %s", mode)
-					logger.Errorf("[MAIN]: %s", err.Error())
-					return err
-				}
-				for _, v := range addStrms {
-					var e error
-					if mode == "local" {
-						e = v.GenStrm(false)
-					} else {
-						e = v.GenStrm(true)
-					}
-
-					if e != nil {
-						logger.Warnf("[MAIN]: generate file %s failed: %s", v.Name, e)
-						continue
-					}
-					config.records[v.RemoteDir] = 0
-					added++
-					logger.Infof("[MAIN]: generate file %s success", v.LocalDir+"/"+v.Name)
-				}
-
-				for _, v := range deleteStrms {
-					e := v.Delete()
-
-					if e != nil {
-						logger.Warnf("[MAIN]: delete file %s failed: %s", v.Name, e)
-						continue
+				interval := c.Duration("interval")
+				if interval <= 0 {
+					if err := runUpdate(c, p); err != nil {
+						return err
 					}
-					delete(config.records, v.RemoteDir)
-					deleted++
-				}
-				logger.Infof("[MAIN]: want to add %d files, want to delete %d files", len(addStrms), len(deleteStrms))
-				logger.Infof("[MAIN]: ignored %d files, added %d files, deleted %d files", ignored, added, deleted)
-				if err := SaveRecordCollection(config.records); err != nil {
-					logger.Errorf("[MAIN]: save record collection failed: %s", err)
-					return err
+					p.Wait()
+					return nil
 				}
-				logger.FinishBar()
-				p.Wait()
-				return nil
+				return runScheduled(c.String("config"), interval, func() error {
+					return runUpdate(c, p)
+				})
 			},
 		},
 		{
 			Name:  "update-database",
 			Usage: "clean database and get all local strm files stored in database",
+			Flags: append([]cli.Flag{
+				&cli.StringFlag{
+					Name:  "report",
+					Usage: "write unparseable and foreign local strm files to csv `FILE`",
+				},
+			}, selectorFlags()...),
 			Action: func(c *cli.Context) error {
 				PrintDebugInfo()
 
+				endpoints, err := selectEndpoints(c)
+				if err != nil {
+					return err
+				}
 				records := make(map[string]int, 0)
-				for _, e := range config.Endpoints {
-					strms := fetchLocalFiles(e)
+				report := &StrmReport{}
+				for _, e := range endpoints {
+					strms := fetchLocalFiles(e, report)
 					for _, v := range strms {
+						if v.Foreign {
+							continue
+						}
 						records[v.RemoteDir] = 0
 					}
 				}
+				report.LogSummary()
+				if file := c.String("report"); file != "" {
+					if err := report.WriteCSV(file); err != nil {
+						logger.Warnf("[MAIN]: write report %s failed: %s", file, err)
+					}
+				}
 				logger.Infof("[MAIN]: %d records found", len(records))
+				if !newSelector(c).Empty() {
+					// 只替换选中目录的记录，保留其他目录的记录
+					if old, err := GetRecordCollection(); err == nil {
+						for k, v := range old {
+							if _, ok := records[k]; !ok && !inRemoteDirs(k, endpoints) {
+								records[k] = v
+							}
+						}
+					}
+				}
 				logger.Tracef("[MAIN]: records: %+v", records)
 				if err := SaveRecordCollection(records); err != nil {
 					logger.Errorf("[MAIN]: save record collection failed: %s", err)
@@ -238,7 +210,7 @@ func main() {
 		{
 			Name:  "check",
 			Usage: "check if strm file is valid",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.StringFlag{
 					Name:  "valid",
 					Usage: "valid strm list path",
@@ -249,23 +221,154 @@ func main() {
 					Usage: "invalid strm list path",
 					Value: "invalid.csv",
 				},
-			},
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "report format, support: csv, json",
+					Value: "csv",
+				},
+				&cli.IntFlag{
+					Name:  "workers",
+					Usage: "number of concurrent checks",
+					Value: 10,
+				},
+				&cli.StringFlag{
+					Name:  "strategy",
+					Usage: "check strategy, support: http, api. http: request every strm url, api: list each remote directory once via alist api",
+					Value: "http",
+				},
+				&cli.BoolFlag{
+					Name:  "range",
+					Usage: "use ranged GET instead of HEAD to confirm bytes are actually served",
+					Value: false,
+				},
+				&cli.BoolFlag{
+					Name:  "fix",
+					Usage: "rewrite invalid strm files to files renamed in the same remote directory (files moved to other directories are not searched), or move them with their nfo and sidecar files to quarantine directory",
+					Value: false,
+				},
+				&cli.StringFlag{
+					Name:  "quarantine",
+					Usage: "quarantine `DIR` for invalid strm files which can not be fixed and their nfo and sidecar files",
+					Value: "quarantine",
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "with --fix, only print what would be done",
+					Value: false,
+				},
+			}, selectorFlags()...),
 			Action: func(c *cli.Context) error {
 				PrintDebugInfo()
 
-				localstrms := func() []*Strm {
-					strms := make([]*Strm, 0)
-					for _, e := range config.Endpoints {
-						strms = append(strms, fetchLocalFiles(e)...)
+				format := c.String("format")
+				if format != "csv" && format != "json" {
+					err := fmt.Errorf("invalid report format: %s", format)
+					logger.Errorf("[MAIN]: %s", err.Error())
+					return err
+				}
+				strategy := c.String("strategy")
+				if strategy != "http" && strategy != "api" {
+					err := fmt.Errorf("invalid check strategy: %s", strategy)
+					logger.Errorf("[MAIN]: %s", err.Error())
+					return err
+				}
+				bar := statusBar(p)
+				logger.SetBar(bar)
+
+				endpoints, err := selectEndpoints(c)
+				if err != nil {
+					return err
+				}
+				valid := make([]*CheckResult, 0)
+				invalid := make([]*CheckResult, 0)
+				stats := make(map[string]int)
+				for _, e := range endpoints {
+					strms := fetchLocalFiles(e, nil)
+					logger.SetTotal(int64(len(strms)) + logger.GetCurrent())
+					var results []*CheckResult
+					if strategy == "api" {
+						var err error
+						results, err = checkStrmsByAPI(e, strms, c.Int("workers"))
+						if err != nil {
+							logger.Errorf("[MAIN]: %s", err.Error())
+							continue
+						}
+					} else {
+						results = checkStrms(strms, newHTTPClient(e, config.Timeout), c.Int("workers"), c.Bool("range"))
 					}
-					return strms
-				}()
-				for _, strm := range localstrms {
-					if !strm.Check() {
-						logger.Infof("[MAIN]: %s invalid, consider remove it, content: %s", strm.LocalDir+"/"+strm.Name, strm.RawURL)
-						continue
+					for _, r := range results {
+						stats[r.Status]++
+						if r.Valid() {
+							logger.Debugf("[MAIN]: %s valid, content: %s", r.Path, r.RawURL)
+							valid = append(valid, r)
+							continue
+						}
+						logger.Infof("[MAIN]: %s invalid (%s), consider remove it, content: %s", r.Path, r.Status, r.RawURL)
+						invalid = append(invalid, r)
+					}
+					if c.Bool("fix") {
+						rewritten, quarantined, err := fixStrms(e, results, c.String("quarantine"), c.Bool("dry-run"))
+						if err != nil {
+							logger.Errorf("[MAIN]: %s", err.Error())
+							continue
+						}
+						logger.Infof("[MAIN]: %s: %d strm files rewritten, %d strm files quarantined", e.BaseURL, rewritten, quarantined)
 					}
-					logger.Debugf("[MAIN]: %s valid, content: %s", strm.LocalDir+"/"+strm.Name, strm.RawURL)
+				}
+				logger.Infof("[MAIN]: %d valid, %d invalid, details: %v", len(valid), len(invalid), stats)
+				if err := writeCheckResults(c.String("valid"), format, valid); err != nil {
+					logger.Errorf("[MAIN]: write valid list failed: %s", err)
+					return err
+				}
+				if err := writeCheckResults(c.String("invalid"), format, invalid); err != nil {
+					logger.Errorf("[MAIN]: write invalid list failed: %s", err)
+					return err
+				}
+				logger.FinishBar()
+				p.Wait()
+				return nil
+			},
+		},
+		{
+			Name:  "config",
+			Usage: "manage configuration file",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "check",
+					Usage: "check configuration file and report all problems",
+					Action: func(c *cli.Context) error {
+						file := c.String("config")
+						cfg, err := loadConfig(file)
+						if err != nil {
+							logger.Errorf("[MAIN]: load config error: %s", err.Error())
+							return err
+						}
+						problems := cfg.Validate()
+						for _, p := range problems {
+							if p.Warning {
+								logger.Warnf("[MAIN]: %s", p)
+							} else {
+								logger.Errorf("[MAIN]: %s", p)
+							}
+						}
+						if n := configErrors(problems); n > 0 {
+							return fmt.Errorf("config file %s has %d errors and %d warnings", file, n, len(problems)-n)
+						}
+						logger.Infof("[MAIN]: config file %s is valid, %d warnings", file, len(problems))
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "init",
+			Usage: "generate configuration file interactively by browsing alist",
+			Action: func(c *cli.Context) error {
+				// 显示光标以便输入
+				fmt.Print("\033[?25h")
+				if err := initConfig(c.String("config")); err != nil {
+					logger.Errorf("[MAIN]: init config error: %s", err.Error())
+					return err
 				}
 				return nil
 			},
@@ -285,3 +388,163 @@ func main() {
 		log.Printf("%s\n", e.Error())
 	}
 }
+
+// runUpdate 执行一次update命令
+func runUpdate(c *cli.Context, p *mpb.Progress) error {
+	var err error
+	bar := statusBar(p)
+	logger.SetBar(bar)
+
+	PrintDebugInfo()
+
+	endpoints, err := selectEndpoints(c)
+	if err != nil {
+		return err
+	}
+
+	mode := c.String("mode")
+	logger.Debugf("[MAIN]: update mode: %s", mode)
+	config.isIncrementalUpdate = !c.Bool("no-incremental-update")
+	logger.Debugf("[MAIN]: incremental update: %t", config.isIncrementalUpdate)
+	config.organizeReport = &OrganizeReport{}
+	config.records, err = GetRecordCollection()
+	if err != nil {
+		err := errors.New("get record collection error: " + err.Error())
+		logger.Errorf("[MAIN]: %s", err.Error())
+		return err
+	}
+	localStrms := make(map[string]*Strm, 0)
+	remoteStrms := make(map[string]*Strm, 0)
+	addStrms := make([]*Strm, 0)
+	deleteStrms := make([]*Strm, 0)
+	// 已存在的strm文件，用于更新对应的nfo文件
+	existStrms := make([]*Strm, 0)
+	report := &StrmReport{}
+	ignored, added, deleted, sidecars, nfos := 0, 0, 0, 0, 0
+	switch mode {
+	case "local":
+		for _, e := range endpoints {
+			localData := fetchLocalFiles(e, report)
+			logger.Infof("[MAIN]: fetched %d local files", len(localData))
+			for _, v := range localData {
+				localStrms[v.Key()] = v
+			}
+			remoteData := fetchRemoteFiles(e, p)
+			logger.Infof("[MAIN]: fetched %d remote files", len(remoteData))
+			for _, v := range remoteData {
+				if _, ok := localStrms[v.Key()]; !ok {
+					addStrms = append(addStrms, v)
+					logger.Debugf("[MAIN]: %s 已加入待保存列表", v.Name)
+					logger.Tracef("[MAIN]: raw_url: %s", v.RawURL)
+				} else {
+					ignored++
+					local := *localStrms[v.Key()]
+					local.NFO, local.SidecarNFO = v.NFO, v.SidecarNFO
+					existStrms = append(existStrms, &local)
+					logger.Debugf("[MAIN]: %s already exits, ignored.", v.Name)
+					logger.Tracef("[MAIN]: local content: %s", localStrms[v.Key()].RawURL)
+					logger.Tracef("[MAIN]: remote content: %s", v.RawURL)
+				}
+			}
+		}
+	case "remote":
+		for _, e := range endpoints {
+			for _, v := range fetchRemoteFiles(e, p) {
+				remoteStrms[v.Key()] = v
+			}
+			for _, v := range fetchLocalFiles(e, report) {
+				if _, ok := remoteStrms[v.Key()]; !ok {
+					if v.Foreign && !c.Bool("delete-foreign") {
+						ignored++
+						logger.Debugf("[MAIN]: %s is foreign, ignored.", v.LocalDir+"/"+v.Name)
+						continue
+					}
+					deleteStrms = append(deleteStrms, v)
+				} else {
+					ignored++
+					v.NFO, v.SidecarNFO = remoteStrms[v.Key()].NFO, remoteStrms[v.Key()].SidecarNFO
+					existStrms = append(existStrms, v)
+					logger.Infof("[MAIN]: %s already exits, ignored.", v.Name)
+					logger.Tracef("[MAIN]: local content: %s", v.RawURL)
+					logger.Tracef("[MAIN]: remote content: %s", remoteStrms[v.Key()].RawURL)
+				}
+			}
+		}
+	default:
+		err := fmt.Errorf("invalid update mode: %s", mode)
+		logger.Errorf("[MAIN]: %s", err.Error())
+		return err
+	}
+	generated := make([]*Strm, 0, len(addStrms))
+	for _, v := range addStrms {
+		var e error
+		if mode == "local" {
+			e = v.GenStrm(false)
+		} else {
+			e = v.GenStrm(true)
+		}
+
+		if e != nil {
+			logger.Warnf("[MAIN]: generate file %s failed: %s", v.Name, e)
+			continue
+		}
+		config.records[v.RemoteDir] = 0
+		generated = append(generated, v)
+		added++
+		logger.Infof("[MAIN]: generate file %s success", v.LocalDir+"/"+v.Name)
+	}
+	for _, v := range append(generated, existStrms...) {
+		if v.NFO == nil || v.SidecarNFO {
+			continue
+		}
+		ok, e := v.GenNFO(v.NFO.ProviderIDs)
+		if e != nil {
+			logger.Warnf("[MAIN]: generate nfo for %s failed: %s", v.Name, e)
+			continue
+		}
+		if ok {
+			nfos++
+			logger.Debugf("[MAIN]: generate nfo %s success", v.NFOPath())
+		}
+	}
+
+	for _, v := range deleteStrms {
+		e := v.Delete()
+
+		if e != nil {
+			logger.Warnf("[MAIN]: delete file %s failed: %s", v.Name, e)
+			continue
+		}
+		delete(config.records, v.RemoteDir)
+		deleted++
+		sidecars += deleteSidecarsOf(v)
+		if ok, e := v.DeleteNFO(); e != nil {
+			logger.Warnf("[MAIN]: delete nfo %s failed: %s", v.NFOPath(), e)
+		} else if ok {
+			sidecars++
+		}
+	}
+	report.LogSummary()
+	if file := c.String("report"); file != "" {
+		if err := report.WriteCSV(file); err != nil {
+			logger.Warnf("[MAIN]: write report %s failed: %s", file, err)
+		}
+	}
+	config.organizeReport.LogSummary()
+	if file := c.String("organize-report"); file != "" {
+		if err := config.organizeReport.WriteCSV(file); err != nil {
+			logger.Warnf("[MAIN]: write organize report %s failed: %s", file, err)
+		}
+	}
+	logger.Infof("[MAIN]: want to add %d files, want to delete %d files", len(addStrms), len(deleteStrms))
+	logger.Infof("[MAIN]: ignored %d files, added %d files, deleted %d files and %d sidecars, wrote %d nfo files", ignored, added, deleted, sidecars, nfos)
+	if err := SaveStrms(generated); err != nil {
+		logger.Warnf("[MAIN]: save strm info failed: %s", err)
+	}
+	if err := SaveRecordCollection(config.records); err != nil {
+		logger.Errorf("[MAIN]: save record collection failed: %s", err)
+		return err
+	}
+	logger.FinishBar()
+	return nil
+}
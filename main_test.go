@@ -0,0 +1,13 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	logger = NewLogger()
+	logger.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
@@ -1,8 +1,6 @@
 package main
 
 import (
-	"io"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -20,10 +18,25 @@ type Mission struct {
 	BaseURL              string
 	Exts                 []string
 	AltExts              []string
+	MediaTypes           []int
 	IsCreateSubDirectory bool
 	IsRecursive          bool
 	IsForceRefresh       bool
-	client               *sdk.Client
+	Refresh              RefreshPolicy // 开启强制刷新时，按策略选择需要刷新的目录
+	Timeout              int           // 请求和下载额外文件的超时时间，秒
+	Filter               *FileFilter
+	Namer                *Namer
+	Organizer            *Organizer
+	NFO                  *NFO
+	Grouping             *Grouping
+	Output               *Output
+	RemoteRoot           string // remote-directories中对应的目录
+	LocalRoot            string // local-directory
+	depth                int    // 当前目录相对于RemoteRoot的层数，RemoteRoot为0
+	modified             string // 当前目录的修改时间，RemoteRoot为空
+	refreshed            *refreshLog
+	client               *AlistClient
+	downloader           *Downloader
 	wg                   *sync.WaitGroup
 	concurrentChan       chan int
 }
@@ -34,15 +47,28 @@ func (m *Mission) getStrm(strmChan chan *Strm) {
 		m.concurrentChan <- threadIdx
 		m.wg.Done()
 	}()
-	alistFiles, err := m.client.List(m.CurrentRemotePath, "", 1, 0, m.IsForceRefresh)
+	refresh := m.forceRefresh()
+	listed := time.Now()
+	alistFiles, hashInfo, err := m.client.ListWithHashes(m.CurrentRemotePath, "", 1, 0, refresh)
 	if err != nil {
 		logger.Errorf("[thread %2d]: get files from [%s] error: %s", threadIdx, m.CurrentRemotePath, err.Error())
 		return
 	}
+	if refresh {
+		logger.Debugf("[thread %2d]: force refreshed [%s]", threadIdx, m.CurrentRemotePath)
+		m.refreshed.Add(m.BaseURL+m.CurrentRemotePath, listed)
+	}
 	logger.Debugf("[thread %2d]: get %d files from [%s]", threadIdx, len(alistFiles), m.CurrentRemotePath)
+	altFiles := make([]sdk.File, 0)
+	// 当前目录中的媒体文件，用于识别多版本和分段
+	items := make([]groupItem, 0)
 	for _, f := range alistFiles {
 		if f.IsDir && m.IsRecursive {
 			logger.Debugf("[thread %2d]: found directory [%s]", threadIdx, m.CurrentRemotePath+"/"+f.Name)
+			if !m.Filter.AllowDir(m.CurrentRemotePath+"/"+f.Name, f.Name) {
+				logger.Debugf("[thread %2d]: directory [%s] excluded by filter, skip", threadIdx, m.CurrentRemotePath+"/"+f.Name)
+				continue
+			}
 			if _, ok := config.records[m.CurrentRemotePath+"/"+f.Name]; ok && config.isIncrementalUpdate {
 				logger.Debugf("[thread %2d]: directory [%s] already processed and use incremental update, skip", threadIdx, m.CurrentRemotePath+"/"+f.Name)
 				continue
@@ -52,108 +78,292 @@ func (m *Mission) getStrm(strmChan chan *Strm) {
 				CurrentRemotePath: m.CurrentRemotePath + "/" + f.Name,
 				LocalPath: func() string {
 					if m.IsCreateSubDirectory {
-						return path.Join(m.LocalPath, f.Name)
+						return path.Join(m.LocalPath, m.Namer.SubDir(f.Name))
 					} else {
 						return m.LocalPath
 					}
 				}(),
 				Exts:                 m.Exts,
 				AltExts:              m.AltExts,
+				MediaTypes:           m.MediaTypes,
 				IsCreateSubDirectory: m.IsCreateSubDirectory,
 				IsRecursive:          m.IsRecursive,
 				IsForceRefresh:       m.IsForceRefresh,
+				Refresh:              m.Refresh,
+				Timeout:              m.Timeout,
+				Filter:               m.Filter,
+				Namer:                m.Namer,
+				Organizer:            m.Organizer,
+				NFO:                  m.NFO,
+				Grouping:             m.Grouping,
+				Output:               m.Output,
+				RemoteRoot:           m.RemoteRoot,
+				LocalRoot:            m.LocalRoot,
+				depth:                m.depth + 1,
+				modified:             f.Modified,
+				refreshed:            m.refreshed,
 				client:               m.client,
+				downloader:           m.downloader,
 				wg:                   m.wg,
 				concurrentChan:       m.concurrentChan,
 			}
 			m.wg.Add(1)
 			go mm.getStrm(strmChan)
 		} else if !f.IsDir {
-			if checkExt(f.Name, m.Exts) {
-				strm := &Strm{
-					Name: func() string {
-						//change f.Name to Upper letter except the extension and return the name with extension .strm
-						ext := filepath.Ext(f.Name)
-						name := strings.TrimSuffix(f.Name, ext)
-						//name = strings.ToUpper(name)
-						//return replaceSpaceToDash(name) + ".strm"
-						return name + ".strm"
-					}(),
-					RemoteDir: m.CurrentRemotePath,
-					LocalDir:  m.LocalPath,
-					RawURL:    m.BaseURL + "/d" + m.CurrentRemotePath + "/" + f.Name,
-					//RawURL:    m.BaseURL + "/d" + urlEncode(m.CurrentRemotePath+"/"+f.Name), //urlEncode is not necessary
-				}
-				strmChan <- strm
-				logger.Add(1)
-			} else if checkExt(f.Name, m.AltExts) {
-				// check if the file is in the altExts list
-				// if it is, download the file to the current local directory
-				logger.Debugf("[thread %2d]: found file [%s], download to [%s]", threadIdx, m.CurrentRemotePath+"/"+f.Name, m.LocalPath)
-				// 检查文件是否已存在
-				filePath := path.Join(m.LocalPath, f.Name)
-				if _, statErr := os.Stat(filePath); statErr == nil {
-					logger.Debugf("[thread %2d]: file [%s] already exists, skip download", threadIdx, filePath)
+			if m.isMedia(f) {
+				if !m.Filter.AllowFile(m.CurrentRemotePath+"/"+f.Name, f) {
+					logger.Debugf("[thread %2d]: file [%s] excluded by filter, skip", threadIdx, m.CurrentRemotePath+"/"+f.Name)
 					continue
 				}
-
-				// 下载文件
-				req, err := http.NewRequest("GET", m.BaseURL+"/d"+m.CurrentRemotePath+"/"+f.Name, nil)
+				dir, name, err := m.Namer.StrmPath(NewNameData(m.RemoteRoot, m.CurrentRemotePath, f.Name))
 				if err != nil {
-					logger.Errorf("[thread %2d]: create request for [%s] error: %s", threadIdx, m.BaseURL+"/d"+m.CurrentRemotePath+"/"+f.Name, err.Error())
+					logger.Errorf("[thread %2d]: %s", threadIdx, err.Error())
 					continue
 				}
-
-				// 设置常见的浏览器User-Agent
-				req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-
-				resp, err := http.DefaultClient.Do(req)
-				if err != nil {
-					logger.Errorf("[thread %2d]: download [%s] error: %s", threadIdx, m.BaseURL+"/d"+m.CurrentRemotePath+"/"+f.Name, err.Error())
-					continue
+				strm := &Strm{
+					Name:      name,
+					RemoteDir: m.CurrentRemotePath,
+					LocalDir: func() string {
+						if m.Namer.HasTemplate() {
+							return path.Join(m.LocalRoot, dir)
+						}
+						return path.Join(m.LocalPath, dir)
+					}(),
+					Size:   f.Size,
+					NFO:    m.NFO,
+					RawURL: m.BaseURL + "/d" + m.CurrentRemotePath + "/" + f.Name,
+					//RawURL:    m.BaseURL + "/d" + urlEncode(m.CurrentRemotePath+"/"+f.Name), //urlEncode is not necessary
 				}
-				defer resp.Body.Close()
+				// 按媒体类型整理目录结构
+				m.Organizer.Organize(strm, m.RemoteRoot, m.LocalRoot, f.Name)
+				items = append(items, groupItem{strm: strm, name: f.Name})
+			} else if checkExt(f.Name, m.AltExts) {
+				altFiles = append(altFiles, f)
+			}
+		}
+	}
+	m.Grouping.Group(items)
+	m.Organizer.Dedupe(items)
+	// 在多版本和分段命名后记录媒体文件对应的strm，额外文件使用重命名后的名称
+	medias := mediasOf(items)
+	strms := make([]*Strm, 0, len(items))
+	for _, item := range items {
+		if err := m.Output.Apply(item.strm, item.name); err != nil {
+			logger.Errorf("[thread %2d]: %s", threadIdx, err.Error())
+			continue
+		}
+		strms = append(strms, item.strm)
+	}
+	// 额外文件的本地路径，需要在输出格式确定strm的文件名后计算
+	altPaths := make([]string, len(altFiles))
+	for i, f := range altFiles {
+		altPaths[i] = sidecarPath(f.Name, medias, m.LocalPath)
+		markSidecarNFO(altPaths[i], strms)
+	}
+	for _, s := range strms {
+		strmChan <- s
+		logger.Add(1)
+	}
+	// check if the file is in the altExts list
+	// if it is, download the file to the local directory of the media files
+	for i, f := range altFiles {
+		m.syncAltFile(threadIdx, f, hashInfo[f.Name], altPaths[i])
+	}
+}
 
-				// 创建目标文件
-				err = os.MkdirAll(m.LocalPath, 0755)
-				if err != nil {
-					logger.Errorf("[thread %2d]: create directory [%s] error: %s", threadIdx, m.LocalPath, err.Error())
-					continue
-				}
-				out, err := os.Create(filePath)
-				if err != nil {
-					logger.Errorf("[thread %2d]: create file [%s] error: %s", threadIdx, filePath, err.Error())
-					continue
-				}
-				defer out.Close()
+// markSidecarNFO 额外文件为strm对应的nfo（同名的nfo或同目录中的movie.nfo）时，标记该strm不再生成nfo
+func markSidecarNFO(localPath string, strms []*Strm) {
+	if !strings.EqualFold(path.Ext(localPath), ".nfo") {
+		return
+	}
+	for _, s := range strms {
+		if localPath == s.NFOPath() || path.Dir(localPath) == path.Clean(s.LocalDir) && path.Base(localPath) == "movie.nfo" {
+			s.SidecarNFO = true
+		}
+	}
+}
 
-				// 写入文件
-				_, err = io.Copy(out, resp.Body)
-				if err != nil {
-					logger.Errorf("[thread %2d]: write file [%s] error: %s", threadIdx, filePath, err.Error())
-					continue
-				}
+// mediasOf 返回媒体文件名（不含扩展名）对应的strm，用于确定额外文件的位置
+func mediasOf(items []groupItem) map[string]*Strm {
+	medias := make(map[string]*Strm, len(items))
+	for _, item := range items {
+		medias[strings.TrimSuffix(item.name, filepath.Ext(item.name))] = item.strm
+	}
+	return medias
+}
 
-				// 检查文件大小是否匹配
-				fileInfo, err := os.Stat(filePath)
-				if err != nil {
-					logger.Errorf("[thread %2d]: get file info [%s] error: %s", threadIdx, filePath, err.Error())
-					os.Remove(filePath)
-					continue
-				}
+// sidecarPath 计算额外文件的本地路径，medias为同一远程目录中媒体文件名（不含扩展名）对应的strm，需要在多版本和分段命名后调用
+//
+// 文件名以媒体文件名开头时放在该媒体文件的目录中，并将开头的媒体文件名替换为strm的文件名（如 Movie.2160p.nfo -> Movie - 2160p.nfo），
+// 所有媒体文件在同一目录时放在该目录中，否则放在默认目录中。字幕文件能对应到唯一的strm时，重命名为该strm的文件名
+func sidecarPath(name string, medias map[string]*Strm, defaultDir string) string {
+	var matched string
+	for base := range medias {
+		if strings.HasPrefix(name, base+".") && len(base) > len(matched) {
+			matched = base
+		}
+	}
+	if matched != "" {
+		s := medias[matched]
+		if isSubtitle(name) {
+			return path.Join(s.LocalDir, subtitleName(name, matched, s))
+		}
+		if s.Format == FormatM3U {
+			return path.Join(s.LocalDir, name)
+		}
+		return path.Join(s.LocalDir, strings.TrimSuffix(s.Name, filepath.Ext(s.Name))+name[len(matched):])
+	}
+	var only *Strm
+	for _, v := range medias {
+		if only != nil && only.LocalDir != v.LocalDir {
+			return path.Join(defaultDir, name)
+		}
+		only = v
+	}
+	if only == nil {
+		return path.Join(defaultDir, name)
+	}
+	if len(medias) == 1 && isSubtitle(name) {
+		return path.Join(only.LocalDir, subtitleName(name, "", only))
+	}
+	return path.Join(only.LocalDir, name)
+}
 
-				if fileInfo.Size() != f.Size {
-					logger.Errorf("[thread %2d]: file size mismatch for [%s], expected %d but got %d",
-						threadIdx, filePath, f.Size, fileInfo.Size())
-					os.Remove(filePath)
-					continue
-				}
+// forceRefresh 判断当前目录是否需要强制刷新
+func (m *Mission) forceRefresh() bool {
+	return m.IsForceRefresh && m.Refresh.Allow(m.BaseURL+m.CurrentRemotePath, m.depth, m.modified)
+}
 
-				logger.Debugf("[thread %2d]: successfully downloaded [%s] to [%s], size %d bytes",
-					threadIdx, m.BaseURL+"/d"+m.CurrentRemotePath+"/"+f.Name, filePath, fileInfo.Size())
+// isMedia 判断文件是否为需要生成strm的媒体文件，配置了MediaTypes时按alist返回的文件类型判断，否则按扩展名判断
+func (m *Mission) isMedia(f sdk.File) bool {
+	return isMediaFile(f, m.Exts, m.MediaTypes)
+}
 
+// isMediaFile 配置了types时按alist返回的文件类型判断，否则按扩展名判断
+func isMediaFile(f sdk.File, exts []string, types []int) bool {
+	if len(types) == 0 {
+		return checkExt(f.Name, exts)
+	}
+	for _, t := range types {
+		if f.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// syncAltFile 根据同步策略下载额外文件到本地路径，并记录到数据库中，listed为目录列表中返回的hash信息
+//
+// 列表中没有hash信息时，只有本地文件的大小或修改时间与远程不一致才通过fs/get获取，避免每个文件多请求一次
+func (m *Mission) syncAltFile(threadIdx int, f sdk.File, listed map[string]string, filePath string) {
+	remotePath := m.CurrentRemotePath + "/" + f.Name
+	policy := altExtPolicy(f.Name)
+	logger.Debugf("[thread %2d]: found file [%s], sync to [%s] with policy %s", threadIdx, remotePath, filePath, policy)
+	m.moveSidecar(threadIdx, remotePath, filePath)
+	// 之前生成的nfo会使远程的nfo被当作已存在而跳过，先删除
+	if record := GetNFORecord(filePath); record != nil && GetSidecar(filePath) == nil {
+		if err := record.Delete(); err != nil {
+			logger.Warnf("[thread %2d]: delete generated nfo [%s] error: %s", threadIdx, filePath, err.Error())
+		}
+	}
+	sidecar := &Sidecar{
+		LocalPath:  filePath,
+		RemotePath: remotePath,
+		Size:       f.Size,
+		Modified:   f.Modified,
+	}
+	hashes := listed
+	// 检查文件是否已存在
+	if info, statErr := os.Stat(filePath); statErr == nil {
+		tracked := GetSidecar(filePath)
+		switch {
+		case policy != AltExtPolicySync:
+			logger.Debugf("[thread %2d]: file [%s] already exists, skip download", threadIdx, filePath)
+			if tracked == nil {
+				m.saveSidecar(threadIdx, sidecar)
+			}
+			return
+		case tracked == nil && info.Size() == f.Size:
+			// 首次记录已存在的文件，大小一致时认为未变化
+			logger.Debugf("[thread %2d]: file [%s] already exists, start tracking", threadIdx, filePath)
+			m.saveSidecar(threadIdx, sidecar)
+			return
+		case tracked != nil && !tracked.Changed(f.Size, f.Modified):
+			logger.Debugf("[thread %2d]: file [%s] not changed, skip download", threadIdx, filePath)
+			return
+		case tracked != nil && tracked.Hash != "":
+			// 修改时间变化但内容可能未变，比较hash避免重复下载
+			hashes = m.hashInfo(threadIdx, remotePath, hashes)
+			if tracked.SameContent(hashes) {
+				logger.Debugf("[thread %2d]: file [%s] content not changed, skip download", threadIdx, filePath)
+				sidecar.HashType, sidecar.Hash = tracked.HashType, tracked.Hash
+				m.saveSidecar(threadIdx, sidecar)
+				return
 			}
 		}
+		logger.Infof("[thread %2d]: file [%s] changed, download again", threadIdx, remotePath)
+		hashes = m.hashInfo(threadIdx, remotePath, hashes)
+	}
+	m.downloader.Add(&DownloadTask{
+		URL:      m.BaseURL + "/d" + remotePath,
+		FilePath: filePath,
+		Size:     f.Size,
+		Hashes:   hashes,
+		Timeout:  time.Duration(m.Timeout) * time.Second,
+		OnDone: func(t *DownloadTask) {
+			sidecar.HashType, sidecar.Hash = t.HashType, t.Hash
+			m.saveSidecar(threadIdx, sidecar)
+		},
+	})
+}
+
+// moveSidecar 本地路径变化时（如strm被命名规则或多版本规则重命名），将已下载的文件移动到新的路径
+func (m *Mission) moveSidecar(threadIdx int, remotePath, filePath string) {
+	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
+		return
+	}
+	old := GetSidecarByRemotePath(remotePath)
+	// 同一远程文件可能被同步到多个本地目录，只移动当前本地根目录中的文件
+	if old == nil || old.Key() == filepath.Clean(filePath) || !inLocalDir(old.LocalPath, m.LocalRoot) {
+		return
+	}
+	if _, err := os.Stat(old.LocalPath); err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		logger.Warnf("[thread %2d]: create directory for [%s] error: %s", threadIdx, filePath, err.Error())
+		return
+	}
+	if err := os.Rename(old.LocalPath, filePath); err != nil {
+		logger.Warnf("[thread %2d]: move [%s] to [%s] error: %s", threadIdx, old.LocalPath, filePath, err.Error())
+		return
+	}
+	if err := old.Delete(); err != nil {
+		logger.Warnf("[thread %2d]: delete sidecar record [%s] error: %s", threadIdx, old.LocalPath, err.Error())
+	}
+	logger.Infof("[thread %2d]: move [%s] to [%s]", threadIdx, old.LocalPath, filePath)
+	moved := *old
+	moved.LocalPath = filePath
+	m.saveSidecar(threadIdx, &moved)
+}
+
+// hashInfo 列表中有hash信息时直接使用，否则通过fs/get获取，获取失败时返回空map，只校验文件大小
+func (m *Mission) hashInfo(threadIdx int, remotePath string, listed map[string]string) map[string]string {
+	if len(listed) > 0 {
+		return listed
+	}
+	hashes, err := m.client.GetHashInfo(remotePath)
+	if err != nil {
+		logger.Debugf("[thread %2d]: get hash info of [%s] error: %s", threadIdx, remotePath, err.Error())
+		return map[string]string{}
+	}
+	return hashes
+}
+
+// saveSidecar 保存额外文件记录
+func (m *Mission) saveSidecar(threadIdx int, sidecar *Sidecar) {
+	if err := sidecar.Save(); err != nil {
+		logger.Warnf("[thread %2d]: save sidecar [%s] error: %s", threadIdx, sidecar.LocalPath, err.Error())
 	}
 }
 
@@ -168,6 +378,9 @@ func (m *Mission) GetAllStrm(concurrentNum int) []*Strm {
 		logger.Debugf("[MAIN]: Push thread %d to concurrent channel", i)
 		m.concurrentChan <- i
 	}
+	// 记录强制刷新的目录列表时间，任务结束后统一保存
+	m.refreshed = m.Refresh.newRefreshLog()
+	defer m.refreshed.Flush()
 	// 创建一个等待组
 	m.wg = &sync.WaitGroup{}
 	// 向等待组添加一个计数
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Naming 目录的输出命名规则
+type Naming struct {
+	// Template 使用text/template语法，结果为相对于local-directory的strm文件路径，如
+	// {{.Parent}}/{{.Title}} ({{.Year}})/{{.Title}}.strm，为空时使用远程文件名
+	Template string `json:"template" yaml:"template"`
+	// Sanitize 替换SMB/NTFS共享中不允许的字符
+	Sanitize bool `json:"sanitize" yaml:"sanitize"`
+	// CollapseDiscs 去除 Disc 1、CD2 等分碟目录
+	CollapseDiscs bool `json:"collapse-discs" yaml:"collapse-discs"`
+	// StripJunk 去除文件名中的发布组、分辨率、编码等信息
+	StripJunk bool `json:"strip-junk" yaml:"strip-junk"`
+}
+
+// NameData 命名模板中可以使用的变量
+type NameData struct {
+	Name      string // 远程文件名，不含扩展名
+	Ext       string // 远程文件扩展名，如 .mkv
+	Parent    string // 远程文件所在目录的名称
+	RemoteDir string // 远程文件所在目录的完整路径
+	RelDir    string // 远程文件所在目录相对于remote-directories中对应目录的路径
+	Title     string // 从文件名中解析出的标题
+	Year      string // 从文件名中解析出的年份，没有时为空
+}
+
+// Namer 编译后的命名规则
+type Namer struct {
+	naming   Naming
+	template *template.Template
+}
+
+var (
+	// SMB/NTFS 中不允许出现在文件名中的字符
+	illegalNameChars = strings.NewReplacer(
+		":", " -", "\"", "'", "<", "_", ">", "_", "|", "_", "?", "_", "*", "_", "\\", "_",
+	)
+	// Windows 保留的文件名
+	reservedNames = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[1-9]|lpt[1-9])(\..*)?$`)
+	// 分碟目录，如 Disc 1、CD2、DVD-1
+	discDirPattern = regexp.MustCompile(`(?i)^(disc|disk|cd|dvd)[\s._-]*\d+$`)
+	// 分辨率、编码、来源等发布信息，出现后的内容都会被去除
+	junkTokenPattern = regexp.MustCompile(`(?i)^(480p|576p|720p|1080[pi]|2160p|x264|x265|h\.?264|h\.?265|hevc|10bit|bluray|blu-ray|bdrip|brrip|web-?dl|webrip|hdtv|dvdrip|remux|hdr10|ddp?5\.1|truehd)$`)
+	// 也可能是标题中普通单词的发布信息，如 The.DV.Story，只在年份之后才去除
+	weakJunkTokenPattern = regexp.MustCompile(`(?i)^(4k|uhd|avc|web|hdr|dv|dovi|aac|ac3|dts|atmos|proper|repack)$`)
+	// 单独的年份
+	yearTokenPattern = regexp.MustCompile(`^(?:19|20)\d{2}$`)
+	// 开头的发布组，如 [Group]
+	leadingGroupPattern = regexp.MustCompile(`^\s*\[[^\]]*\]\s*`)
+	// 年份
+	yearPattern = regexp.MustCompile(`(?:^|[\s._(\[-])((?:19|20)\d{2})(?:$|[\s._)\]-])`)
+	// 名称中的分隔符
+	separatorPattern = regexp.MustCompile(`[._]+`)
+)
+
+// Compile 检查并编译命名规则，没有配置任何规则时返回nil
+func (n Naming) Compile() (*Namer, error) {
+	if n == (Naming{}) {
+		return nil, nil
+	}
+	namer := &Namer{naming: n}
+	if n.Template != "" {
+		t, err := template.New("naming").Funcs(template.FuncMap{
+			"sanitize":  sanitizeName,
+			"stripJunk": stripJunk,
+			"upper":     strings.ToUpper,
+			"lower":     strings.ToLower,
+			"trim":      strings.TrimSpace,
+			"replace":   strings.ReplaceAll,
+		}).Option("missingkey=error").Parse(n.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid naming template: %s", err.Error())
+		}
+		namer.template = t
+	}
+	return namer, nil
+}
+
+// sanitizeName 替换SMB/NTFS共享中不允许的字符，并去除结尾的空格和.
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, name)
+	name = illegalNameChars.Replace(name)
+	name = strings.TrimRight(name, " .")
+	if reservedNames.MatchString(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+// stripJunk 去除文件名开头的[发布组]，以及分辨率、编码、来源等信息之后的所有内容
+func stripJunk(name string) string {
+	title, _ := splitJunk(name)
+	return title
+}
+
+// splitJunk 将文件名分为标题和分辨率、编码、来源等信息两部分，如 Movie.2160p.HDR 分为 Movie 和 2160p HDR
+//
+// DV、WEB、PROPER 等可能是普通单词的信息只在年份之后才识别，如 The.DV.Story.2020.1080p 的标题为 The DV Story 2020
+func splitJunk(name string) (string, string) {
+	name = leadingGroupPattern.ReplaceAllString(name, "")
+	tokens := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '.' || r == ' ' || r == '_' || r == '[' || r == ']'
+	})
+	junk := ""
+	afterYear := false
+	for i, token := range tokens {
+		token = strings.Trim(token, "-()")
+		if i == 0 {
+			continue
+		}
+		if junkTokenPattern.MatchString(token) || afterYear && weakJunkTokenPattern.MatchString(token) {
+			junk = strings.Trim(strings.Join(tokens[i:], " "), " -")
+			tokens = tokens[:i]
+			break
+		}
+		afterYear = afterYear || yearTokenPattern.MatchString(token)
+	}
+	return strings.Trim(strings.Join(tokens, " "), " -"), junk
+}
+
+// lastYear 返回名称中最后一个年份的起止位置，没有时返回-1；开头的年份是标题的一部分，如 2001.A.Space.Odyssey、1917
+func lastYear(name string) (int, int) {
+	start, end := -1, -1
+	// 年份前后的分隔符会被匹配消耗，逐个查找以免漏掉相邻的年份，如 1917.2019
+	for offset := 0; offset < len(name); {
+		loc := yearPattern.FindStringSubmatchIndex(name[offset:])
+		if loc == nil {
+			break
+		}
+		if offset+loc[2] > 0 {
+			start, end = offset+loc[2], offset+loc[3]
+		}
+		offset += loc[3]
+	}
+	return start, end
+}
+
+// parseTitleYear 从文件名中解析标题和年份，使用最后一个年份，如 Blade Runner 2049 (2017) 的年份为2017，
+// 没有年份时标题为去除分隔符的文件名
+func parseTitleYear(name string) (title, year string) {
+	name = leadingGroupPattern.ReplaceAllString(name, "")
+	if start, end := lastYear(name); start > 0 {
+		title, year = name[:start], name[start:end]
+	} else {
+		title = stripJunk(name)
+	}
+	title = separatorPattern.ReplaceAllString(title, " ")
+	title = strings.Trim(strings.TrimSpace(title), "-([")
+	return strings.TrimSpace(title), year
+}
+
+// NewNameData 根据远程文件生成命名模板使用的变量，remoteRoot为remote-directories中对应的目录
+func NewNameData(remoteRoot, remoteDir, fileName string) *NameData {
+	ext := filepath.Ext(fileName)
+	name := strings.TrimSuffix(fileName, ext)
+	rel := strings.TrimPrefix(strings.TrimPrefix(remoteDir, remoteRoot), "/")
+	data := &NameData{
+		Name:      name,
+		Ext:       ext,
+		Parent:    path.Base(remoteDir),
+		RemoteDir: remoteDir,
+		RelDir:    rel,
+	}
+	data.Title, data.Year = parseTitleYear(name)
+	return data
+}
+
+// HasTemplate 判断是否配置了命名模板，配置时strm路径相对于local-directory，否则相对于当前本地目录
+func (n *Namer) HasTemplate() bool {
+	return n != nil && n.template != nil
+}
+
+// StrmPath 计算strm文件的相对目录和文件名
+func (n *Namer) StrmPath(data *NameData) (string, string, error) {
+	var rel string
+	if n.HasTemplate() {
+		buf := &bytes.Buffer{}
+		if err := n.template.Execute(buf, data); err != nil {
+			return "", "", fmt.Errorf("execute naming template error: %s", err.Error())
+		}
+		rel = strings.TrimSpace(buf.String())
+		if !strings.HasSuffix(strings.ToLower(rel), ".strm") {
+			rel += ".strm"
+		}
+	} else {
+		name := data.Name
+		if n != nil && n.naming.StripJunk {
+			name = stripJunk(name)
+		}
+		rel = name + ".strm"
+	}
+	dir, name := n.cleanPath(rel)
+	if name == "" || name == ".strm" {
+		return "", "", fmt.Errorf("empty strm name for %s", data.Name+data.Ext)
+	}
+	return dir, name, nil
+}
+
+// SubDir 按规则处理不使用模板时创建的子目录名，返回空字符串时表示不创建子目录
+func (n *Namer) SubDir(name string) string {
+	dir, _ := n.cleanPath(name + "/_")
+	return dir
+}
+
+// cleanPath 按规则处理相对路径中的每一级，返回目录和文件名
+func (n *Namer) cleanPath(rel string) (string, string) {
+	segments := make([]string, 0)
+	for _, seg := range strings.Split(path.Clean("/"+rel), "/") {
+		if seg == "" {
+			continue
+		}
+		segments = append(segments, seg)
+	}
+	if len(segments) == 0 {
+		return "", ""
+	}
+	name := segments[len(segments)-1]
+	dirs := make([]string, 0, len(segments)-1)
+	for _, seg := range segments[:len(segments)-1] {
+		if n != nil && n.naming.CollapseDiscs && discDirPattern.MatchString(seg) {
+			continue
+		}
+		if n != nil && n.naming.Sanitize {
+			seg = sanitizeName(seg)
+		}
+		if seg != "" {
+			dirs = append(dirs, seg)
+		}
+	}
+	if n != nil && n.naming.Sanitize {
+		name = sanitizeName(name)
+	}
+	return path.Join(dirs...), name
+}
@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestParseTitleYear(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		year  string
+	}{
+		{"Inception.2010.1080p.BluRay.x264", "Inception", "2010"},
+		{"Inception (2010)", "Inception", "2010"},
+		{"[Group] Inception [2010]", "Inception", "2010"},
+		{"Blade Runner 2049 (2017)", "Blade Runner 2049", "2017"},
+		{"2001.A.Space.Odyssey.1968", "2001 A Space Odyssey", "1968"},
+		{"1917.2019.2160p", "1917", "2019"},
+		{"2012", "2012", ""},
+		{"Movie.1080p.WEB-DL", "Movie", ""},
+		{"Some_Show_S01E02", "Some Show S01E02", ""},
+	}
+	for _, tt := range tests {
+		title, year := parseTitleYear(tt.name)
+		if title != tt.title || year != tt.year {
+			t.Errorf("parseTitleYear(%q) = %q, %q, want %q, %q", tt.name, title, year, tt.title, tt.year)
+		}
+	}
+}
+
+func TestSplitJunk(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		junk  string
+	}{
+		{"Movie.2160p.HDR", "Movie", "2160p HDR"},
+		{"Movie.2010.1080p.BluRay.x264-GRP", "Movie 2010", "1080p BluRay x264-GRP"},
+		{"[Group] Movie [1080p]", "Movie", "1080p"},
+		{"The.DV.Story.2020.1080p", "The DV Story 2020", "1080p"},
+		{"Web.of.Lies.2021.WEB.DV", "Web of Lies 2021", "WEB DV"},
+		{"Proper.Manners.2019.PROPER.720p", "Proper Manners 2019", "PROPER 720p"},
+		{"HDR.Life", "HDR Life", ""},
+		{"Movie - 2160p", "Movie", "2160p"},
+		{"Movie (2010) - 4K", "Movie (2010)", "4K"},
+		{"Movie", "Movie", ""},
+	}
+	for _, tt := range tests {
+		title, junk := splitJunk(tt.name)
+		if title != tt.title || junk != tt.junk {
+			t.Errorf("splitJunk(%q) = %q, %q, want %q, %q", tt.name, title, junk, tt.title, tt.junk)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// NFO 生成nfo文件的规则
+type NFO struct {
+	Enabled     bool `json:"enabled" yaml:"enabled"`
+	ProviderIDs bool `json:"provider-ids" yaml:"provider-ids"` // 从目录名中解析 [tmdbid=123]、{imdb-tt123} 等ID
+}
+
+// 目录名中的ID，如 [tmdbid=123]、{tmdb-123}、[imdbid-tt123]、{tvdb-456}
+var providerIDPattern = regexp.MustCompile(`(?i)[\[{]\s*(tmdb|imdb|tvdb)(?:id)?\s*[=-]\s*([a-z0-9]+)\s*[\]}]`)
+
+type nfoUniqueID struct {
+	Type    string `xml:"type,attr"`
+	Default bool   `xml:"default,attr,omitempty"`
+	Value   string `xml:",chardata"`
+}
+
+type movieNFO struct {
+	XMLName   xml.Name      `xml:"movie"`
+	Title     string        `xml:"title"`
+	Year      string        `xml:"year,omitempty"`
+	UniqueIDs []nfoUniqueID `xml:"uniqueid"`
+}
+
+// 目录名中的ID属于剧集而不是单集，因此单集的nfo中不写入ID
+type episodeNFO struct {
+	XMLName   xml.Name `xml:"episodedetails"`
+	Title     string   `xml:"title"`
+	ShowTitle string   `xml:"showtitle"`
+	Season    int      `xml:"season"`
+	Episode   int      `xml:"episode"`
+}
+
+// parseProviderIDs 从远程路径中解析ID，越靠近文件的目录优先级越高
+func parseProviderIDs(remotePath string) []nfoUniqueID {
+	ids := make([]nfoUniqueID, 0)
+	seen := make(map[string]bool)
+	segments := strings.Split(remotePath, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		for _, m := range providerIDPattern.FindAllStringSubmatch(segments[i], -1) {
+			t := strings.ToLower(m[1])
+			if seen[t] {
+				continue
+			}
+			seen[t] = true
+			ids = append(ids, nfoUniqueID{Type: t, Value: m[2], Default: len(ids) == 0})
+		}
+	}
+	return ids
+}
+
+// NFOPath 返回strm文件对应的nfo文件路径
+func (s *Strm) NFOPath() string {
+	return path.Join(s.LocalDir, strings.TrimSuffix(s.Name, filepath.Ext(s.Name))+".nfo")
+}
+
+// NFOContent 根据远程路径生成nfo文件内容
+func (s *Strm) NFOContent(withIDs bool) ([]byte, error) {
+	_, fileName, err := parseStrmURL(s.RawURL, "")
+	if err != nil {
+		return nil, err
+	}
+	var ids []nfoUniqueID
+	if withIDs {
+		ids = parseProviderIDs(s.RemoteDir + "/" + fileName)
+	}
+	var v interface{}
+	info := parseMediaInfo(s.RemoteDir, fileName)
+	switch {
+	case info == nil:
+		title, year := parseTitleYear(strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+		v = &movieNFO{Title: title, Year: year, UniqueIDs: ids}
+	case info.IsEpisode():
+		v = &episodeNFO{
+			Title:     fmt.Sprintf("%s S%02dE%02d", info.Title, info.Season, info.Episode),
+			ShowTitle: info.Title,
+			Season:    info.Season,
+			Episode:   info.Episode,
+		}
+	default:
+		v = &movieNFO{Title: info.Title, Year: info.Year, UniqueIDs: ids}
+	}
+	byts, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(byts, '\n')...), nil
+}
+
+// NFORecord 记录一个生成的nfo文件，与strm一起更新和删除
+type NFORecord struct {
+	Path    string `json:"path"`
+	StrmKey string `json:"strm_key"`
+}
+
+// GetNFORecord 根据nfo路径获取记录，不存在时返回nil
+func GetNFORecord(nfoPath string) *NFORecord {
+	var record *NFORecord
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("nfo"))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(filepath.Clean(nfoPath)))
+		if v == nil {
+			return nil
+		}
+		record = &NFORecord{}
+		return json.Unmarshal(v, record)
+	})
+	return record
+}
+
+// Save 保存nfo记录
+func (r *NFORecord) Save() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("nfo"))
+		if err != nil {
+			return err
+		}
+		byts, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(filepath.Clean(r.Path)), byts)
+	})
+}
+
+// Delete 删除nfo文件及记录
+func (r *NFORecord) Delete() error {
+	if err := os.Remove(r.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("nfo"))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(filepath.Clean(r.Path)))
+	})
+}
+
+// GenNFO 在strm文件旁生成nfo文件，不会覆盖下载的或用户自己的nfo文件，返回是否写入了文件
+func (s *Strm) GenNFO(withIDs bool) (bool, error) {
+	if s.Format == FormatM3U {
+		// 播放列表包含多个文件，不生成nfo
+		return false, nil
+	}
+	nfoPath := s.NFOPath()
+	record := GetNFORecord(nfoPath)
+	if _, err := os.Stat(nfoPath); err == nil && (record == nil || GetSidecar(nfoPath) != nil) {
+		// 已存在不是由本程序生成的nfo文件
+		return false, nil
+	}
+	content, err := s.NFOContent(withIDs)
+	if err != nil {
+		return false, err
+	}
+	if old, err := os.ReadFile(nfoPath); err == nil && bytes.Equal(old, content) {
+		return false, nil
+	}
+	if err := os.MkdirAll(s.LocalDir, 0755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(nfoPath, content, 0666); err != nil {
+		return false, err
+	}
+	return true, (&NFORecord{Path: nfoPath, StrmKey: s.Key()}).Save()
+}
+
+// DeleteNFO 删除strm文件对应的由本程序生成的nfo文件
+func (s *Strm) DeleteNFO() (bool, error) {
+	nfoPath := s.NFOPath()
+	record := GetNFORecord(nfoPath)
+	if record == nil || record.StrmKey != s.Key() || GetSidecar(nfoPath) != nil {
+		return false, nil
+	}
+	return true, record.Delete()
+}
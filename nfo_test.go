@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestMarkSidecarNFO(t *testing.T) {
+	tests := []struct {
+		name      string
+		localPath string
+		want      []bool
+	}{
+		{"same name", "media/Movie/Movie - 2160p.nfo", []bool{false, true, false}},
+		{"movie.nfo", "media/Movie/movie.nfo", []bool{true, true, false}},
+		{"other version", "media/Movie/Movie.nfo", []bool{false, false, false}},
+		{"not nfo", "media/Movie/Movie - 1080p.srt", []bool{false, false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strms := []*Strm{
+				{Name: "Movie - 1080p.strm", LocalDir: "media/Movie"},
+				{Name: "Movie - 2160p.strm", LocalDir: "media/Movie/"},
+				{Name: "Other.strm", LocalDir: "media/Other"},
+			}
+			markSidecarNFO(tt.localPath, strms)
+			for i, s := range strms {
+				if s.SidecarNFO != tt.want[i] {
+					t.Errorf("markSidecarNFO(%q) %s = %v, want %v", tt.localPath, s.Name, s.SidecarNFO, tt.want[i])
+				}
+			}
+		})
+	}
+}
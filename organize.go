@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Organize 按媒体类型整理strm文件的规则，整理后的目录结构为
+//
+//	Movies/Title (Year)/Title (Year).strm
+//	Shows/Title/Season NN/Title SNNENN.strm
+//	Unmatched/原始目录/文件名.strm
+type Organize struct {
+	Enabled      bool   `json:"enabled" yaml:"enabled"`
+	MoviesDir    string `json:"movies-dir" yaml:"movies-dir"`       // 默认 Movies
+	ShowsDir     string `json:"shows-dir" yaml:"shows-dir"`         // 默认 Shows
+	UnmatchedDir string `json:"unmatched-dir" yaml:"unmatched-dir"` // 默认 Unmatched
+}
+
+// MediaInfo 从远程路径中解析出的媒体信息
+type MediaInfo struct {
+	Title   string
+	Year    string
+	Season  int
+	Episode int
+}
+
+// IsEpisode 判断是否为剧集
+func (i *MediaInfo) IsEpisode() bool {
+	return i.Episode > 0
+}
+
+var (
+	// S01E02、s1e2
+	episodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,2})[\s._-]*e(\d{1,3})(?:[^0-9]|$)`)
+	// 1x02
+	crossEpisodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{1,2})x(\d{2,3})(?:[^0-9]|$)`)
+	// 第2集、第02话
+	chineseEpisodePattern = regexp.MustCompile(`第\s*(\d{1,3})\s*[集话話]`)
+	// 字幕组常用的 Title - 05、Title - 05v2 [1080p]
+	dashEpisodePattern = regexp.MustCompile(`(?i)\s-\s(\d{1,3})(?:v\d)?(?:[\s\[(]|$)`)
+	// EP02、E02
+	bareEpisodePattern = regexp.MustCompile(`(?i)(?:^|[^a-z0-9])ep?(\d{1,3})(?:[^0-9]|$)`)
+	// 目录名中的季，如 Season 1、S01、第1季
+	seasonDirPattern = regexp.MustCompile(`(?i)^(?:season[\s._-]*(\d{1,2})|s(\d{1,2})|第\s*(\d{1,2})\s*季)$`)
+)
+
+// parseMediaInfo 从远程目录和文件名中解析标题、年份、季和集，文件名中没有年份时使用所在目录的标题和年份，
+// 无法识别为剧集且没有年份时返回nil
+func parseMediaInfo(remoteDir, fileName string) *MediaInfo {
+	name := strings.TrimSuffix(fileName, path.Ext(fileName))
+	info := &MediaInfo{}
+	season, episode, idx := -1, 0, -1
+	if loc := episodePattern.FindStringSubmatchIndex(name); loc != nil {
+		season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		episode, _ = strconv.Atoi(name[loc[4]:loc[5]])
+		idx = loc[0]
+	} else if loc := crossEpisodePattern.FindStringSubmatchIndex(name); loc != nil {
+		season, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		episode, _ = strconv.Atoi(name[loc[4]:loc[5]])
+		idx = loc[0]
+	} else if loc := chineseEpisodePattern.FindStringSubmatchIndex(name); loc != nil {
+		episode, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		idx = loc[0]
+	} else if loc := dashEpisodePattern.FindStringSubmatchIndex(name); loc != nil && loc[0] > 0 {
+		episode, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		idx = loc[0]
+	} else if loc := bareEpisodePattern.FindStringSubmatchIndex(name); loc != nil && seasonFromDir(path.Base(remoteDir)) > 0 {
+		// 只有在季目录中时才把 E02 识别为集数，避免误判
+		episode, _ = strconv.Atoi(name[loc[2]:loc[3]])
+		idx = loc[0]
+	}
+
+	if episode > 0 {
+		info.Episode = episode
+		info.Season = season
+		dir := remoteDir
+		if s := seasonFromDir(path.Base(dir)); s > 0 {
+			if info.Season < 0 {
+				info.Season = s
+			}
+			dir = path.Dir(dir)
+		}
+		if info.Season < 0 {
+			info.Season = 1
+		}
+		// 文件名中集数前的部分为剧名，没有时使用目录名
+		info.Title, info.Year = parseTitleYear(name[:idx])
+		if info.Title == "" {
+			info.Title, info.Year = parseTitleYear(path.Base(dir))
+		}
+		if info.Title == "" || info.Title == "/" {
+			return nil
+		}
+		return info
+	}
+
+	info.Title, info.Year = parseTitleYear(name)
+	if info.Year == "" {
+		// 文件名中没有年份时使用所在目录，如 Avatar (2009)/Avatar.mkv
+		if title, year := parseTitleYear(path.Base(remoteDir)); year != "" && title != "" {
+			info.Title, info.Year = title, year
+		}
+	}
+	if info.Year == "" || info.Title == "" {
+		return nil
+	}
+	return info
+}
+
+// seasonFromDir 从目录名中解析季，不是季目录时返回0
+func seasonFromDir(name string) int {
+	m := seasonDirPattern.FindStringSubmatch(strings.TrimSpace(name))
+	if m == nil {
+		return 0
+	}
+	for _, v := range m[1:] {
+		if v != "" {
+			n, _ := strconv.Atoi(v)
+			return n
+		}
+	}
+	return 0
+}
+
+// OrganizeProblem 记录一个无法识别的远程文件
+type OrganizeProblem struct {
+	RemotePath string
+	LocalPath  string
+}
+
+// OrganizeReport 记录整理过程中无法识别的文件，可以被多个线程同时使用
+type OrganizeReport struct {
+	mu        sync.Mutex
+	Movies    int
+	Episodes  int
+	Unmatched []OrganizeProblem
+}
+
+func (r *OrganizeReport) add(info *MediaInfo, remotePath, localPath string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case info == nil:
+		r.Unmatched = append(r.Unmatched, OrganizeProblem{RemotePath: remotePath, LocalPath: localPath})
+	case info.IsEpisode():
+		r.Episodes++
+	default:
+		r.Movies++
+	}
+}
+
+// LogSummary 输出整理结果摘要
+func (r *OrganizeReport) LogSummary() {
+	if r == nil || r.Movies+r.Episodes+len(r.Unmatched) == 0 {
+		return
+	}
+	logger.Infof("[MAIN]: organized %d movies and %d episodes, %d files unmatched", r.Movies, r.Episodes, len(r.Unmatched))
+	for _, v := range r.Unmatched {
+		logger.Debugf("[MAIN]: unmatched %s -> %s", v.RemotePath, v.LocalPath)
+	}
+}
+
+// WriteCSV 将无法识别的文件写入csv文件，格式为 remote_path,local_path
+func (r *OrganizeReport) WriteCSV(file string) error {
+	lines := make([][]string, 0, len(r.Unmatched))
+	for _, v := range r.Unmatched {
+		lines = append(lines, []string{v.RemotePath, v.LocalPath})
+	}
+	return writeCSV(file, []string{"remote_path", "local_path"}, lines)
+}
+
+// Organizer 编译后的整理规则
+type Organizer struct {
+	organize Organize
+	report   *OrganizeReport
+}
+
+// Compile 检查整理规则并填充默认值，未启用时返回nil
+func (o Organize) Compile(report *OrganizeReport) (*Organizer, error) {
+	if !o.Enabled {
+		return nil, nil
+	}
+	if o.MoviesDir == "" {
+		o.MoviesDir = "Movies"
+	}
+	if o.ShowsDir == "" {
+		o.ShowsDir = "Shows"
+	}
+	if o.UnmatchedDir == "" {
+		o.UnmatchedDir = "Unmatched"
+	}
+	for _, dir := range []string{o.MoviesDir, o.ShowsDir, o.UnmatchedDir} {
+		if path.IsAbs(dir) || strings.HasPrefix(path.Clean(dir), "..") {
+			return nil, fmt.Errorf("organize directory %q must be relative to local-directory", dir)
+		}
+	}
+	return &Organizer{organize: o, report: report}, nil
+}
+
+// Organize 根据解析出的媒体信息重新计算strm文件的本地目录和文件名，localRoot为local-directory，remoteRoot为remote-directories中对应的目录
+func (o *Organizer) Organize(s *Strm, remoteRoot, localRoot, fileName string) {
+	if o == nil {
+		return
+	}
+	info := parseMediaInfo(s.RemoteDir, fileName)
+	switch {
+	case info == nil:
+		rel := strings.TrimPrefix(strings.TrimPrefix(s.RemoteDir, remoteRoot), "/")
+		s.LocalDir = path.Join(localRoot, o.organize.UnmatchedDir, rel)
+	case info.IsEpisode():
+		title := sanitizeName(info.Title)
+		if info.Year != "" {
+			title = fmt.Sprintf("%s (%s)", title, info.Year)
+		}
+		s.LocalDir = path.Join(localRoot, o.organize.ShowsDir, title, fmt.Sprintf("Season %02d", info.Season))
+		s.Name = fmt.Sprintf("%s S%02dE%02d.strm", sanitizeName(info.Title), info.Season, info.Episode)
+	default:
+		title := fmt.Sprintf("%s (%s)", sanitizeName(info.Title), info.Year)
+		s.LocalDir = path.Join(localRoot, o.organize.MoviesDir, title)
+		s.Name = title + ".strm"
+	}
+	o.report.add(info, s.RemoteDir+"/"+fileName, path.Join(s.LocalDir, s.Name))
+}
+
+// Dedupe 整理后同一目录中多个媒体文件对应同一个strm路径时（如同一电影的多个版本或分段），按多版本和分段规则重命名这些文件，
+// 未启用grouping时也会执行，避免后处理的文件覆盖或被丢弃
+func (o *Organizer) Dedupe(items []groupItem) {
+	if o == nil {
+		return
+	}
+	targets := make(map[string]int)
+	for _, item := range items {
+		targets[path.Join(item.strm.LocalDir, item.strm.Name)]++
+	}
+	dups := make([]groupItem, 0)
+	for _, item := range items {
+		if targets[path.Join(item.strm.LocalDir, item.strm.Name)] > 1 {
+			dups = append(dups, item)
+		}
+	}
+	(&Grouping{Versions: true, Parts: true}).Group(dups)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMediaInfo(t *testing.T) {
+	tests := []struct {
+		remoteDir string
+		fileName  string
+		want      *MediaInfo
+	}{
+		{"/movies", "Inception.2010.1080p.mkv", &MediaInfo{Title: "Inception", Year: "2010"}},
+		{"/movies/Avatar (2009)", "Avatar.mkv", &MediaInfo{Title: "Avatar", Year: "2009"}},
+		{"/movies/Avatar (2009)", "Avatar.Extended.2010.mkv", &MediaInfo{Title: "Avatar Extended", Year: "2010"}},
+		{"/movies/Misc", "Home Video.mkv", nil},
+		{"/shows", "Some.Show.S01E02.1080p.mkv", &MediaInfo{Title: "Some Show", Season: 1, Episode: 2}},
+		{"/shows", "Some Show 2x05.mkv", &MediaInfo{Title: "Some Show", Season: 2, Episode: 5}},
+		{"/shows/Some Show (2019)/Season 2", "E03.mkv", &MediaInfo{Title: "Some Show", Year: "2019", Season: 2, Episode: 3}},
+		{"/shows/Some Show/S03", "Some Show S03E04.mkv", &MediaInfo{Title: "Some Show", Season: 3, Episode: 4}},
+		{"/anime", "[Group] Frieren - 05 [1080p].mkv", &MediaInfo{Title: "Frieren", Season: 1, Episode: 5}},
+		{"/anime/Frieren/Season 1", "[Group] Frieren - 12v2 (BD 1080p).mkv", &MediaInfo{Title: "Frieren", Season: 1, Episode: 12}},
+		{"/剧集/繁花", "第03集.mp4", &MediaInfo{Title: "繁花", Season: 1, Episode: 3}},
+		{"/movies", "E03.mkv", nil},
+	}
+	for _, tt := range tests {
+		got := parseMediaInfo(tt.remoteDir, tt.fileName)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMediaInfo(%q, %q) = %+v, want %+v", tt.remoteDir, tt.fileName, got, tt.want)
+		}
+	}
+}
+
+func TestOrganizerDedupe(t *testing.T) {
+	o, err := Organize{Enabled: true}.Compile(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{"versions", []string{"Avatar.2009.1080p.mkv", "Avatar.2009.2160p.mkv"}, []string{"Avatar (2009) - 1080p.strm", "Avatar (2009) - 2160p.strm"}},
+		{"parts", []string{"Avatar.2009.CD1.mkv", "Avatar.2009.CD2.mkv"}, []string{"Avatar (2009)-part1.strm", "Avatar (2009)-part2.strm"}},
+		{"different movies", []string{"Avatar.2009.mkv", "Heat.1995.mkv"}, []string{"Avatar (2009).strm", "Heat (1995).strm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := make([]groupItem, 0, len(tt.files))
+			for _, f := range tt.files {
+				s := &Strm{Name: f, RemoteDir: "/movies", LocalDir: "media"}
+				o.Organize(s, "/movies", "media", f)
+				items = append(items, groupItem{strm: s, name: f})
+			}
+			o.Dedupe(items)
+			for i, item := range items {
+				if item.strm.Name != tt.want[i] {
+					t.Errorf("Dedupe() name of %s = %q, want %q", tt.files[i], item.strm.Name, tt.want[i])
+				}
+			}
+		})
+	}
+}
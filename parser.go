@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// alist 中可直接播放的链接前缀，/d/ 为直链，/p/ 为代理链接，/dav/ 为webdav
+var strmURLMarkers = []string{"/d/", "/p/", "/dav/"}
+
+// parseStrmURL 解析strm文件内容，返回对应的远程目录和文件名
+//
+// 支持以下形式的链接，baseURL 不为空时优先按 baseURL 去除前缀:
+//
+//	http(s)://host[/prefix]/d/path/to/file.mkv[?sign=xxx]
+//	http(s)://host[/prefix]/p/path/to/file.mkv[?sign=xxx]
+//	http(s)://host[/prefix]/dav/path/to/file.mkv
+func parseStrmURL(raw, baseURL string) (remoteDir, name string, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", "", errors.New("empty strm content")
+	}
+	lower := strings.ToLower(raw)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return "", "", fmt.Errorf("not a http(s) url: %s", raw)
+	}
+	// 去除签名参数，文件名中可能包含?，因此只识别 sign 参数
+	if idx := strings.LastIndex(raw, "?sign="); idx > 0 {
+		raw = raw[:idx]
+	}
+
+	var p string
+	base := strings.TrimRight(baseURL, "/")
+	if base != "" && strings.HasPrefix(raw, base+"/") {
+		p = raw[len(base):]
+	} else {
+		rest := raw[strings.Index(raw, "://")+3:]
+		idx := strings.Index(rest, "/")
+		if idx <= 0 {
+			return "", "", fmt.Errorf("url has no host or path: %s", raw)
+		}
+		p = rest[idx:]
+	}
+
+	// 找到最靠前的 alist 链接前缀
+	start := -1
+	for _, marker := range strmURLMarkers {
+		idx := strings.Index(p, marker)
+		if idx >= 0 && (start < 0 || idx < start) {
+			start = idx + len(marker) - 1
+		}
+	}
+	if start < 0 {
+		return "", "", fmt.Errorf("not an alist /d/, /p/ or /dav/ url: %s", raw)
+	}
+	p = urlDecode(p[start:])
+	if strings.HasSuffix(p, "/") {
+		return "", "", fmt.Errorf("url points to a directory: %s", raw)
+	}
+	remoteDir, name = path.Split(p)
+	if name == "" {
+		return "", "", fmt.Errorf("url has no file name: %s", raw)
+	}
+	return path.Clean(remoteDir), name, nil
+}
+
+// StrmProblem 记录一个有问题的本地strm文件
+type StrmProblem struct {
+	Path   string
+	RawURL string
+	Reason string
+}
+
+// StrmReport 记录读取本地strm文件时发现的无法解析或不属于当前服务器的文件
+type StrmReport struct {
+	Unparseable []StrmProblem
+	Foreign     []StrmProblem
+}
+
+// AddUnparseable 记录一个无法解析的strm文件
+func (r *StrmReport) AddUnparseable(file, rawURL string, err error) {
+	if r == nil {
+		return
+	}
+	r.Unparseable = append(r.Unparseable, StrmProblem{Path: file, RawURL: rawURL, Reason: err.Error()})
+}
+
+// AddForeign 记录一个不属于当前服务器的strm文件
+func (r *StrmReport) AddForeign(file, rawURL, baseURL string) {
+	if r == nil {
+		return
+	}
+	r.Foreign = append(r.Foreign, StrmProblem{Path: file, RawURL: rawURL, Reason: "not belong to " + baseURL})
+}
+
+// Empty 判断报告是否为空
+func (r *StrmReport) Empty() bool {
+	return r == nil || len(r.Unparseable)+len(r.Foreign) == 0
+}
+
+// WriteCSV 将报告写入csv文件，格式为 type,path,reason,content
+func (r *StrmReport) WriteCSV(file string) error {
+	lines := make([][]string, 0, len(r.Unparseable)+len(r.Foreign))
+	for _, v := range r.Unparseable {
+		lines = append(lines, []string{"unparseable", v.Path, v.Reason, v.RawURL})
+	}
+	for _, v := range r.Foreign {
+		lines = append(lines, []string{"foreign", v.Path, v.Reason, v.RawURL})
+	}
+	return writeCSV(file, []string{"type", "path", "reason", "content"}, lines)
+}
+
+// LogSummary 输出报告摘要
+func (r *StrmReport) LogSummary() {
+	if r.Empty() {
+		return
+	}
+	logger.Warnf("[MAIN]: found %d unparseable strm files and %d foreign strm files", len(r.Unparseable), len(r.Foreign))
+	for _, v := range r.Unparseable {
+		logger.Debugf("[MAIN]: unparseable strm %s: %s", v.Path, v.Reason)
+	}
+	for _, v := range r.Foreign {
+		logger.Debugf("[MAIN]: foreign strm %s: %s", v.Path, v.RawURL)
+	}
+}
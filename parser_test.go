@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestParseStrmURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		baseURL string
+		dir     string
+		file    string
+		wantErr bool
+	}{
+		{"direct link", "http://alist:5244/d/movies/A.mkv", "", "/movies", "A.mkv", false},
+		{"proxy link", "https://alist.example.com/p/movies/A.mkv", "", "/movies", "A.mkv", false},
+		{"webdav link", "http://alist:5244/dav/movies/A.mkv", "", "/movies", "A.mkv", false},
+		{"sign removed", "http://alist:5244/d/movies/A.mkv?sign=abc=:0", "", "/movies", "A.mkv", false},
+		{"escaped path", "http://alist:5244/d/my%20movies/A%20B.mkv", "", "/my movies", "A B.mkv", false},
+		{"question mark in name", "http://alist:5244/d/movies/What%3F.mkv", "", "/movies", "What?.mkv", false},
+		{"unescaped percent", "http://alist:5244/d/movies/100%.mkv", "", "/movies", "100%.mkv", false},
+		{"surrounding spaces", "  http://alist:5244/d/movies/A.mkv\r\n", "", "/movies", "A.mkv", false},
+		{"sub path base url", "http://host/alist/d/movies/A.mkv", "http://host/alist/", "/movies", "A.mkv", false},
+		{"marker in path", "http://alist:5244/d/p/dav/A.mkv", "", "/p/dav", "A.mkv", false},
+		{"root file", "http://alist:5244/d/A.mkv", "", "/", "A.mkv", false},
+		{"empty", "  ", "", "", "", true},
+		{"not http", "/mnt/movies/A.mkv", "", "", "", true},
+		{"no path", "http://alist:5244", "", "", "", true},
+		{"not alist", "http://alist:5244/movies/A.mkv", "", "", "", true},
+		{"directory", "http://alist:5244/d/movies/", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, file, err := parseStrmURL(tt.raw, tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseStrmURL(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if dir != tt.dir || file != tt.file {
+				t.Errorf("parseStrmURL(%q) = %q, %q, want %q, %q", tt.raw, dir, file, tt.dir, tt.file)
+			}
+		})
+	}
+}
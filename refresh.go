@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// RefreshPolicy 强制刷新策略，开启force-refresh后只有满足所有已配置条件的目录才会强制刷新
+type RefreshPolicy struct {
+	Depth          int           // 只刷新前N层目录，0表示不限制
+	OlderThan      time.Duration // 只刷新缓存的目录列表早于此时长的目录，0表示不限制
+	ModifiedWithin time.Duration // 只刷新在此时长内修改过的目录，0表示不限制
+}
+
+// Allow 判断目录是否需要强制刷新，depth为相对远程根目录的层数，modified为目录的修改时间，未知时为空
+func (p RefreshPolicy) Allow(key string, depth int, modified string) bool {
+	if p.Depth > 0 && depth >= p.Depth {
+		return false
+	}
+	if p.ModifiedWithin > 0 && modified != "" {
+		// 远程根目录没有修改时间，总是刷新
+		if t, err := time.Parse(time.RFC3339Nano, modified); err == nil && time.Since(t) > p.ModifiedWithin {
+			return false
+		}
+	}
+	if p.OlderThan > 0 {
+		if listed := getRefreshTime(key); !listed.IsZero() && time.Since(listed) < p.OlderThan {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshLog 记录一次任务中各目录获取到最新列表的时间，任务结束后一次写入数据库
+type refreshLog struct {
+	sync.Mutex
+	times map[string]time.Time
+}
+
+// newRefreshLog 只在配置了OlderThan时创建记录，否则返回nil
+func (p RefreshPolicy) newRefreshLog() *refreshLog {
+	if p.OlderThan <= 0 {
+		return nil
+	}
+	return &refreshLog{times: make(map[string]time.Time)}
+}
+
+// Add 记录目录列表的获取时间
+func (l *refreshLog) Add(key string, listed time.Time) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.times[key] = listed
+}
+
+// Flush 在一个事务中保存所有记录的列表时间
+func (l *refreshLog) Flush() {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	if len(l.times) == 0 {
+		return
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("refresh"))
+		if err != nil {
+			return err
+		}
+		for key, listed := range l.times {
+			if err := b.Put([]byte(key), []byte(listed.Format(time.RFC3339))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warnf("[MAIN]: save listing time of %d directories failed: %s", len(l.times), err.Error())
+		return
+	}
+	l.times = make(map[string]time.Time)
+}
+
+// getRefreshTime 获取目录缓存列表的获取时间，没有记录时返回零值
+func getRefreshTime(key string) time.Time {
+	var t time.Time
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("refresh"))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			t, _ = time.Parse(time.RFC3339, string(v))
+		}
+		return nil
+	})
+	return t
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshPolicyAllow(t *testing.T) {
+	openTestDB(t)
+	l := RefreshPolicy{OlderThan: time.Hour}.newRefreshLog()
+	l.Add("http://alist/fresh", time.Now().Add(-time.Minute))
+	l.Add("http://alist/stale", time.Now().Add(-2*time.Hour))
+	l.Flush()
+
+	recent := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	old := time.Now().Add(-48 * time.Hour).Format(time.RFC3339Nano)
+	tests := []struct {
+		name     string
+		policy   RefreshPolicy
+		key      string
+		depth    int
+		modified string
+		want     bool
+	}{
+		{"no limits", RefreshPolicy{}, "http://alist/fresh", 5, old, true},
+		{"within depth", RefreshPolicy{Depth: 2}, "", 1, "", true},
+		{"too deep", RefreshPolicy{Depth: 2}, "", 2, "", false},
+		{"modified recently", RefreshPolicy{ModifiedWithin: 24 * time.Hour}, "", 1, recent, true},
+		{"modified long ago", RefreshPolicy{ModifiedWithin: 24 * time.Hour}, "", 1, old, false},
+		{"root without modified", RefreshPolicy{ModifiedWithin: 24 * time.Hour}, "", 0, "", true},
+		{"listing is fresh", RefreshPolicy{OlderThan: time.Hour}, "http://alist/fresh", 0, "", false},
+		{"listing is stale", RefreshPolicy{OlderThan: time.Hour}, "http://alist/stale", 0, "", true},
+		{"listing never recorded", RefreshPolicy{OlderThan: time.Hour}, "http://alist/unknown", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allow(tt.key, tt.depth, tt.modified); got != tt.want {
+				t.Errorf("Allow(%q, %d, %q) = %v, want %v", tt.key, tt.depth, tt.modified, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshLog(t *testing.T) {
+	openTestDB(t)
+	if l := (RefreshPolicy{}).newRefreshLog(); l != nil {
+		t.Fatalf("newRefreshLog() without OlderThan = %v, want nil", l)
+	}
+	// 未配置OlderThan时记录为nil，调用不应出错
+	var l *refreshLog
+	l.Add("http://alist/a", time.Now())
+	l.Flush()
+
+	l = RefreshPolicy{OlderThan: time.Hour}.newRefreshLog()
+	listed := time.Now().Add(-time.Minute).Truncate(time.Second)
+	l.Add("http://alist/a", listed)
+	l.Add("http://alist/b", listed)
+	if got := getRefreshTime("http://alist/a"); !got.IsZero() {
+		t.Fatalf("listing time saved before Flush: %v", got)
+	}
+	l.Flush()
+	for _, key := range []string{"http://alist/a", "http://alist/b"} {
+		if got := getRefreshTime(key); !got.Equal(listed) {
+			t.Errorf("getRefreshTime(%q) = %v, want %v", key, got, listed)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pendingConfig 重新加载并通过检查的配置，在下一次运行前替换当前配置
+var pendingConfig atomic.Pointer[Config]
+
+// reloadConfig 重新读取并检查配置文件，通过检查后立即应用日志设置，并等待下一次运行时替换当前配置
+func reloadConfig(file, database, logFile string) (*Config, error) {
+	c, err := loadConfig(file)
+	if err != nil {
+		return nil, err
+	}
+	problems := c.Validate()
+	for _, p := range problems {
+		if p.Warning {
+			logger.Warnf("[MAIN]: config %s", p)
+		} else {
+			logger.Errorf("[MAIN]: config %s", p)
+		}
+	}
+	if n := configErrors(problems); n > 0 {
+		return nil, fmt.Errorf("config file %s has %d errors", file, n)
+	}
+	// 数据库和日志文件在启动时打开，修改后需要重启
+	if c.Database != database {
+		logger.Warnf("[MAIN]: database changed to %s, restart to take effect", c.Database)
+		c.Database = database
+	}
+	if c.LogFile != logFile {
+		logger.Warnf("[MAIN]: log file changed to %s, restart to take effect", c.LogFile)
+		c.LogFile = logFile
+	}
+	logger.SetFormatter(&Formatter{
+		Colored: c.ColoredLog,
+	})
+	setLogLevel(c.Loglevel)
+	pendingConfig.Store(c)
+	dirs := 0
+	for _, e := range c.Endpoints {
+		for _, d := range e.Dirs {
+			if !d.Disabled {
+				dirs++
+			}
+		}
+	}
+	logger.Infof("[MAIN]: reload config file success, %d endpoints and %d dirs will be used in next update", len(c.Endpoints), dirs)
+	return c, nil
+}
+
+// configWatcher 监听主配置文件和被包含的配置文件及目录
+type configWatcher struct {
+	*fsnotify.Watcher
+	mu    sync.Mutex
+	files map[string]bool // 监听的配置文件
+	dirs  map[string]bool // 被包含的目录，其中的配置文件都需要监听
+}
+
+// watch 更新需要监听的文件和目录，编辑器保存时通常会替换文件，因此监听文件所在的目录
+func (w *configWatcher) watch(paths []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files = make(map[string]bool)
+	w.dirs = make(map[string]bool)
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Dir(abs)
+		if info, err := os.Stat(abs); err == nil && info.IsDir() {
+			w.dirs[abs] = true
+			dir = abs
+		} else {
+			w.files[abs] = true
+		}
+		if err := w.Add(dir); err != nil {
+			logger.Warnf("[MAIN]: watch %s error: %s", dir, err.Error())
+		}
+	}
+}
+
+// changed 判断事件是否为配置文件的修改
+func (w *configWatcher) changed(ev fsnotify.Event) bool {
+	if !ev.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename | fsnotify.Remove) {
+		return false
+	}
+	name, err := filepath.Abs(ev.Name)
+	if err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.files[name] || w.dirs[filepath.Dir(name)] && isConfigFile(name)
+}
+
+// watchConfig 监听配置文件的修改和SIGHUP信号，发生时重新加载配置，返回停止监听的函数
+func watchConfig(file string) func() {
+	database, logFile := config.Database, config.LogFile
+	var watcher *configWatcher
+	reload := func() {
+		c, err := reloadConfig(file, database, logFile)
+		if err != nil {
+			logger.Errorf("[MAIN]: reload config file error: %s, keep using current config", err.Error())
+			return
+		}
+		// include 可能发生了变化
+		if watcher != nil {
+			watcher.watch(c.files)
+		}
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warnf("[MAIN]: watch config file error: %s, only reload on SIGHUP", err.Error())
+	} else {
+		watcher = &configWatcher{Watcher: w}
+		watcher.watch(append([]string{file}, config.files...))
+	}
+	done := make(chan struct{})
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				logger.Info("[MAIN]: received SIGHUP, reload config file")
+				reload()
+			case <-done:
+				return
+			}
+		}
+	}()
+	if watcher == nil {
+		return func() {
+			signal.Stop(hup)
+			close(done)
+		}
+	}
+	go func() {
+		// 一次保存可能产生多个事件，合并后再重新加载
+		var timer *time.Timer
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !watcher.changed(ev) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(time.Second, func() {
+					logger.Info("[MAIN]: config file changed, reload config file")
+					reload()
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warnf("[MAIN]: watch config file error: %s", err.Error())
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(hup)
+		close(done)
+		watcher.Close()
+	}
+}
+
+// runScheduled 按间隔重复执行run，每次执行前替换重新加载的配置
+func runScheduled(file string, interval time.Duration, run func() error) error {
+	stop := watchConfig(file)
+	defer stop()
+	for {
+		if c := pendingConfig.Swap(nil); c != nil {
+			config = c
+			logger.Info("[MAIN]: use reloaded config")
+		}
+		if err := run(); err != nil {
+			logger.Errorf("[MAIN]: update error: %s", err.Error())
+			logger.FinishBar()
+		}
+		logger.Infof("[MAIN]: next update at %s", time.Now().Add(interval).Format("2006-01-02 15:04:05"))
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 配置中的环境变量引用，如 ${ALIST_TOKEN}、${ALIST_USER:-admin}
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// redactedText 日志中替换敏感信息的文本
+const redactedText = "******"
+
+// minSecretLength 短于此长度的密钥只替换完整的单词，避免替换日志中路径、链接等内容的一部分
+const minSecretLength = 8
+
+// interpolateEnv 在解析为Config之前替换合并后配置数据中的环境变量引用，未设置且没有默认值的变量返回错误
+//
+// 替换后按Config中对应配置项的类型转换，如 timeout: ${ALIST_TIMEOUT} 替换为数字，force-refresh: ${REFRESH} 替换为布尔值
+func interpolateEnv(data map[string]interface{}) error {
+	missing := make(map[string]bool)
+	interpolateValue(data, reflect.TypeOf(Config{}), missing)
+	if len(missing) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(missing))
+	for k := range missing {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("environment variables not set: %s", strings.Join(names, ", "))
+}
+
+// interpolateValue 递归替换map和切片中的字符串，t为对应配置项的类型，未知时为nil，只替换不转换
+func interpolateValue(v interface{}, t reflect.Type, missing map[string]bool) interface{} {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch val := v.(type) {
+	case string:
+		expanded := expandEnv(val, missing)
+		if expanded == val || t == nil {
+			return expanded
+		}
+		return convertEnvValue(expanded, t.Kind())
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = interpolateValue(item, fieldType(t, k), missing)
+		}
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i, item := range val {
+			val[i] = interpolateValue(item, elem, missing)
+		}
+	}
+	return v
+}
+
+// convertEnvValue 将替换后的字符串转换为配置项的类型，无法转换时保留字符串，由解析配置时报错
+func convertEnvValue(s string, kind reflect.Kind) interface{} {
+	switch kind {
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s)
+		}
+	}
+	return s
+}
+
+// fieldType 返回结构体中json名称为key的字段类型，包括嵌入结构体的字段，t为map时返回元素类型，找不到时返回nil
+func fieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+	default:
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Anonymous && name == "" {
+			if ft := fieldType(f.Type, key); ft != nil {
+				return ft
+			}
+			continue
+		}
+		if f.IsExported() && name == key {
+			return f.Type
+		}
+	}
+	return nil
+}
+
+// expandEnv 替换字符串中的环境变量引用
+func expandEnv(s string, missing map[string]bool) string {
+	return envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := envPattern.FindStringSubmatch(m)
+		if v, ok := os.LookupEnv(sub[1]); ok {
+			return v
+		}
+		if strings.Contains(m, ":-") {
+			return sub[2]
+		}
+		missing[sub[1]] = true
+		return m
+	})
+}
+
+// readSecretFile 读取密钥文件，如 Docker secrets，去除结尾的换行
+func readSecretFile(file string) (string, error) {
+	byts, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(byts), "\r\n"), nil
+}
+
+// loadSecrets 从token-file和password-file读取密钥，并记录所有密钥用于在日志中隐藏
+func loadSecrets(c *Config) error {
+	for i := range c.Endpoints {
+		e := &c.Endpoints[i]
+		if e.TokenFile != "" {
+			if e.Token != "" {
+				return fmt.Errorf("endpoints[%d]: token and token-file can not be used together", i)
+			}
+			token, err := readSecretFile(e.TokenFile)
+			if err != nil {
+				return fmt.Errorf("endpoints[%d]: read token file error: %s", i, err.Error())
+			}
+			e.Token = token
+		}
+		if e.PasswordFile != "" {
+			if e.Password != "" {
+				return fmt.Errorf("endpoints[%d]: password and password-file can not be used together", i)
+			}
+			password, err := readSecretFile(e.PasswordFile)
+			if err != nil {
+				return fmt.Errorf("endpoints[%d]: read password file error: %s", i, err.Error())
+			}
+			e.Password = password
+		}
+		addSecret(e.Token)
+		addSecret(e.Password)
+	}
+	return nil
+}
+
+// secrets 需要在日志中隐藏的内容
+var secrets = struct {
+	sync.RWMutex
+	values []string
+}{}
+
+// addSecret 记录需要在日志中隐藏的内容
+func addSecret(s string) {
+	if s == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, v := range secrets.values {
+		if v == s {
+			return
+		}
+	}
+	secrets.values = append(secrets.values, s)
+	// 先替换较长的内容，避免只替换一部分
+	sort.Slice(secrets.values, func(i, j int) bool { return len(secrets.values[i]) > len(secrets.values[j]) })
+}
+
+// redactSecrets 将日志中的密钥替换为******
+func redactSecrets(msg string) string {
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for _, v := range secrets.values {
+		if len(v) >= minSecretLength {
+			msg = strings.ReplaceAll(msg, v, redactedText)
+		} else {
+			msg = replaceWord(msg, v, redactedText)
+		}
+	}
+	return msg
+}
+
+// replaceWord 只替换前后不是字母或数字的s
+func replaceWord(msg, s, replacement string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(msg, s)
+		if i < 0 {
+			b.WriteString(msg)
+			return b.String()
+		}
+		end := i + len(s)
+		before, _ := utf8.DecodeLastRuneInString(msg[:i])
+		after, _ := utf8.DecodeRuneInString(msg[end:])
+		b.WriteString(msg[:i])
+		if isWordRune(before) || isWordRune(after) {
+			b.WriteString(s)
+		} else {
+			b.WriteString(replacement)
+		}
+		msg = msg[end:]
+	}
+}
+
+// isWordRune 判断是否为单词中的字符，字符串开头或结尾时为utf8.RuneError
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// redacted 用于输出配置项，已设置时返回******
+func redacted(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redactedText
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	old := secrets.values
+	defer func() { secrets.values = old }()
+	secrets.values = nil
+
+	for _, s := range []string{"", "pw", "t", "token-abcdef", "secret-token"} {
+		addSecret(s)
+	}
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"login with pw", "login with ******"},
+		{"url?password=pw&user=admin", "url?password=******&user=admin"},
+		{"/mnt/pwd/t.mkv", "/mnt/pwd/******.mkv"},
+		{"the token list", "the token list"},
+		{"token: token-abcdef", "token: ******"},
+		{"Bearersecret-token", "Bearer******"},
+		{"nothing here", "nothing here"},
+	}
+	for _, tt := range tests {
+		if got := redactSecrets(tt.msg); got != tt.want {
+			t.Errorf("redactSecrets(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	old := secrets.values
+	defer func() { secrets.values = old }()
+	file := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(file, []byte("s3\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{Endpoints: []Endpoint{{Token: "t", PasswordFile: file}}}
+	if err := loadSecrets(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Endpoints[0].Password != "s3" {
+		t.Errorf("password = %q, want %q", c.Endpoints[0].Password, "s3")
+	}
+	if got := redactSecrets("t s3 test"); got != "****** ****** test" {
+		t.Errorf("short secrets not redacted as whole words: %q", got)
+	}
+	c = &Config{Endpoints: []Endpoint{{Password: "x", PasswordFile: file}}}
+	if err := loadSecrets(c); err == nil {
+		t.Error("password and password-file used together, want error")
+	}
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	t.Setenv("ZZ_ALIST_URL", "http://alist:5244")
+	t.Setenv("ZZ_TIMEOUT", "60")
+	t.Setenv("ZZ_REFRESH", "true")
+	t.Setenv("ZZ_TOKEN", "12345")
+	data := map[string]interface{}{
+		"database": "${ZZ_DB:-strm.db}",
+		"timeout":  "${ZZ_TIMEOUT}",
+		"endpoints": []interface{}{map[string]interface{}{
+			"base-url":        "${ZZ_ALIST_URL}",
+			"token":           "${ZZ_TOKEN}",
+			"max-connections": "${ZZ_CONNECTIONS:-3}",
+			"dirs": []interface{}{map[string]interface{}{
+				"local-directory":    "media",
+				"remote-directories": []interface{}{"/${ZZ_DIR:-movies}"},
+				"force-refresh":      "${ZZ_REFRESH}",
+				"timeout":            "${ZZ_DIR_TIMEOUT:-10}",
+			}},
+		}},
+	}
+	if err := interpolateEnv(data); err != nil {
+		t.Fatal(err)
+	}
+	byts, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	if err := json.Unmarshal(byts, c); err != nil {
+		t.Fatalf("unmarshal interpolated config error: %s", err)
+	}
+	e := c.Endpoints[0]
+	d := e.Dirs[0]
+	if c.Database != "strm.db" || c.Timeout != 60 || e.BaseURL != "http://alist:5244" || e.Token != "12345" || e.MaxConnections != 3 {
+		t.Errorf("interpolateEnv() config = %+v", c)
+	}
+	if d.RemoteDirectories[0].Path != "/movies" || d.ForceRefresh == nil || !*d.ForceRefresh || d.Timeout != 10 {
+		t.Errorf("interpolateEnv() dir = %+v", d)
+	}
+
+	err = interpolateEnv(map[string]interface{}{"endpoints": []interface{}{map[string]interface{}{"username": "${ZZ_MISSING}"}}})
+	if err == nil || err.Error() != "environment variables not set: ZZ_MISSING" {
+		t.Errorf("interpolateEnv() error = %v", err)
+	}
+}
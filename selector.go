@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// selectorFlags 选择服务器和目录的命令行参数
+func selectorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "endpoint",
+			Usage: "only run endpoints with `NAME` or base url, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "dir",
+			Usage: "only run dirs with `NAME` or local directory, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "only run dirs with `TAG`, tags of endpoint are inherited by its dirs, can be repeated",
+		},
+	}
+}
+
+// Selector 命令行中选择的服务器、目录和标签，同一参数的多个值满足其一即可，不同参数需要同时满足
+type Selector struct {
+	Endpoints []string
+	Dirs      []string
+	Tags      []string
+}
+
+func newSelector(c *cli.Context) *Selector {
+	return &Selector{
+		Endpoints: c.StringSlice("endpoint"),
+		Dirs:      c.StringSlice("dir"),
+		Tags:      c.StringSlice("tag"),
+	}
+}
+
+// Empty 判断是否没有选择条件
+func (s *Selector) Empty() bool {
+	return len(s.Endpoints) == 0 && len(s.Dirs) == 0 && len(s.Tags) == 0
+}
+
+// String 用于日志输出
+func (s *Selector) String() string {
+	parts := make([]string, 0, 3)
+	if len(s.Endpoints) > 0 {
+		parts = append(parts, "endpoint="+strings.Join(s.Endpoints, ","))
+	}
+	if len(s.Dirs) > 0 {
+		parts = append(parts, "dir="+strings.Join(s.Dirs, ","))
+	}
+	if len(s.Tags) > 0 {
+		parts = append(parts, "tag="+strings.Join(s.Tags, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// matchAny 判断values中是否有任意一个在candidates中，candidates中的空字符串不参与匹配
+func matchAny(values []string, candidates ...string) bool {
+	for _, v := range values {
+		for _, c := range candidates {
+			if c != "" && v == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Select 返回选中的服务器，服务器中只保留选中的目录；选择条件没有匹配到任何服务器、目录或标签时返回错误
+func (s *Selector) Select(endpoints []Endpoint) ([]Endpoint, error) {
+	if s.Empty() {
+		return endpoints, nil
+	}
+	used := make(map[string]bool)
+	selected := make([]Endpoint, 0)
+	for _, e := range endpoints {
+		names := []string{e.Name, e.BaseURL, strings.TrimRight(e.BaseURL, "/")}
+		for _, v := range names {
+			used["endpoint:"+v] = true
+		}
+		for _, t := range e.Tags {
+			used["tag:"+t] = true
+		}
+		matched := len(s.Endpoints) == 0 || matchAny(s.Endpoints, names...)
+		dirs := make([]Dir, 0)
+		for _, d := range e.Dirs {
+			used["dir:"+d.Name] = true
+			used["dir:"+d.LocalDirectory] = true
+			for _, t := range d.Tags {
+				used["tag:"+t] = true
+			}
+			if !matched || len(s.Dirs) > 0 && !matchAny(s.Dirs, d.Name, d.LocalDirectory) {
+				continue
+			}
+			if len(s.Tags) > 0 && !matchAny(s.Tags, append(append([]string{}, e.Tags...), d.Tags...)...) {
+				continue
+			}
+			dirs = append(dirs, d)
+		}
+		if len(dirs) == 0 {
+			continue
+		}
+		e.Dirs = dirs
+		selected = append(selected, e)
+	}
+	// 拼写错误时不应静默地什么都不做
+	for _, v := range s.Endpoints {
+		if !used["endpoint:"+v] {
+			return nil, fmt.Errorf("no endpoint named %q in config", v)
+		}
+	}
+	for _, v := range s.Dirs {
+		if !used["dir:"+v] {
+			return nil, fmt.Errorf("no dir named %q in config", v)
+		}
+	}
+	for _, v := range s.Tags {
+		if !used["tag:"+v] {
+			return nil, fmt.Errorf("no tag %q in config", v)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no dir matches %s", s)
+	}
+	return selected, nil
+}
+
+// selectEndpoints 按命令行参数选择服务器和目录，并输出选中的目录
+func selectEndpoints(c *cli.Context) ([]Endpoint, error) {
+	s := newSelector(c)
+	endpoints, err := s.Select(config.Endpoints)
+	if err != nil {
+		logger.Errorf("[MAIN]: %s", err.Error())
+		return nil, err
+	}
+	if !s.Empty() {
+		for _, e := range endpoints {
+			for _, d := range e.Dirs {
+				logger.Infof("[MAIN]: selected dir [%s] of %s by %s", d.LocalDirectory, e.BaseURL, s)
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// inRemoteDir 判断远程路径是否为root或在root中
+func inRemoteDir(remotePath, root string) bool {
+	if remotePath == root {
+		return true
+	}
+	root = strings.TrimRight(root, "/")
+	return remotePath == root || strings.HasPrefix(remotePath, root+"/")
+}
+
+// inRemoteDirs 判断远程路径是否在选中目录的远程目录中
+func inRemoteDirs(remotePath string, endpoints []Endpoint) bool {
+	for _, e := range endpoints {
+		for _, d := range e.Dirs {
+			for _, r := range d.RemoteDirectories {
+				if inRemoteDir(remotePath, r.Path) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Overrides 可以在目录和单个远程目录中覆盖的设置，未设置的项继承上一层
+type Overrides struct {
+	Timeout                    int      `json:"timeout" yaml:"timeout"`                                             // request timeout in seconds, 0 inherits
+	MaxConnections             int      `json:"max-connections" yaml:"max-connections"`                             // concurrent requests, 0 inherits
+	ForceRefresh               *bool    `json:"force-refresh" yaml:"force-refresh"`                                 // refresh alist cache when listing
+	ForceRefreshDepth          int      `json:"force-refresh-depth" yaml:"force-refresh-depth"`                     // only refresh the top N levels, 0 inherits (unlimited)
+	ForceRefreshOlderThan      string   `json:"force-refresh-older-than" yaml:"force-refresh-older-than"`           // only refresh directories not refreshed within the duration, e.g. 12h, 7d
+	ForceRefreshModifiedWithin string   `json:"force-refresh-modified-within" yaml:"force-refresh-modified-within"` // only refresh directories modified within the duration, e.g. 3d
+	CreateSubDirectory         *bool    `json:"create-sub-directory" yaml:"create-sub-directory"`                   // keep remote sub directories
+	Exts                       []string `json:"exts" yaml:"exts"`                                                   // override or extend inherited exts
+	AltExts                    []string `json:"alt-exts" yaml:"alt-exts"`                                           // override or extend inherited alt-exts
+	ExtsMode                   string   `json:"exts-mode" yaml:"exts-mode"`                                         // override (default) or extend
+}
+
+// RemoteDirectory remote-directories中的一项，可以是路径字符串，也可以是包含path和覆盖设置的对象
+type RemoteDirectory struct {
+	Path      string `json:"path" yaml:"path"`
+	Overrides `yaml:",inline"`
+}
+
+// UnmarshalJSON 所有格式的配置文件都会先转换为JSON再解析，因此只需要实现JSON的解析
+func (r *RemoteDirectory) UnmarshalJSON(data []byte) error {
+	var p string
+	if err := json.Unmarshal(data, &p); err == nil {
+		*r = RemoteDirectory{Path: p}
+		return nil
+	}
+	// 使用别名避免递归调用UnmarshalJSON
+	type remoteDirectory RemoteDirectory
+	v := remoteDirectory{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("remote directory must be a path or an object with path: %s", err.Error())
+	}
+	*r = RemoteDirectory(v)
+	return nil
+}
+
+// remotePaths 返回远程目录的路径
+func remotePaths(dirs []RemoteDirectory) []string {
+	paths := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		paths = append(paths, d.Path)
+	}
+	return paths
+}
+
+// Settings 远程目录实际使用的设置，按 全局 → 服务器 → 目录 → 远程目录 逐层继承
+type Settings struct {
+	Timeout            int
+	MaxConnections     int
+	ForceRefresh       bool
+	Refresh            RefreshPolicy
+	CreateSubDirectory bool
+	Exts               []string
+	AltExts            []string
+}
+
+// baseSettings 返回服务器层级的设置
+func (c *Config) baseSettings(e Endpoint) Settings {
+	return Settings{
+		Timeout:            c.Timeout,
+		MaxConnections:     e.MaxConnections,
+		CreateSubDirectory: c.CreateSubDirectory,
+		Exts:               normalizeExts(c.Exts),
+		AltExts:            normalizeExts(c.AltExts),
+	}
+}
+
+// Apply 使用下一层的覆盖设置，返回新的设置
+func (s Settings) Apply(o Overrides) Settings {
+	if o.Timeout > 0 {
+		s.Timeout = o.Timeout
+	}
+	if o.MaxConnections > 0 {
+		s.MaxConnections = o.MaxConnections
+	}
+	if o.ForceRefresh != nil {
+		s.ForceRefresh = *o.ForceRefresh
+	}
+	if o.ForceRefreshDepth > 0 {
+		s.Refresh.Depth = o.ForceRefreshDepth
+	}
+	// 时长格式错误时由Validate报告
+	if d, err := parseDuration(o.ForceRefreshOlderThan); o.ForceRefreshOlderThan != "" && err == nil {
+		s.Refresh.OlderThan = d
+	}
+	if d, err := parseDuration(o.ForceRefreshModifiedWithin); o.ForceRefreshModifiedWithin != "" && err == nil {
+		s.Refresh.ModifiedWithin = d
+	}
+	if o.CreateSubDirectory != nil {
+		s.CreateSubDirectory = *o.CreateSubDirectory
+	}
+	s.Exts = o.resolveExts(s.Exts, o.Exts)
+	s.AltExts = o.resolveExts(s.AltExts, o.AltExts)
+	return s
+}
+
+// Settings 返回目录中一个远程目录实际使用的设置
+func (d Dir) Settings(e Endpoint, remote RemoteDirectory) Settings {
+	return config.baseSettings(e).Apply(d.Overrides).Apply(remote.Overrides)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSettingsApply(t *testing.T) {
+	old := config
+	defer func() { config = old }()
+	config = &Config{Timeout: 30, CreateSubDirectory: true, Exts: []string{".mkv", "MP4"}, AltExts: []string{".srt"}}
+
+	yes, no := true, false
+	e := Endpoint{MaxConnections: 5}
+	d := Dir{Overrides: Overrides{
+		MaxConnections:     2,
+		CreateSubDirectory: &no,
+		Exts:               []string{".iso"},
+		ExtsMode:           ExtsModeExtend,
+		ForceRefresh:       &yes,
+		ForceRefreshDepth:  2,
+	}}
+	tests := []struct {
+		name   string
+		remote RemoteDirectory
+		want   Settings
+	}{
+		{"dir overrides", RemoteDirectory{Path: "/movies"}, Settings{
+			Timeout: 30, MaxConnections: 2, ForceRefresh: true, Refresh: RefreshPolicy{Depth: 2},
+			Exts: []string{".mkv", ".mp4", ".iso"}, AltExts: []string{".srt"},
+		}},
+		{"remote directory overrides", RemoteDirectory{Path: "/4k", Overrides: Overrides{
+			Timeout:               120,
+			ForceRefresh:          &no,
+			ForceRefreshOlderThan: "7d",
+			CreateSubDirectory:    &yes,
+			Exts:                  []string{".ts"},
+			AltExts:               []string{".ass"},
+			ExtsMode:              ExtsModeExtend,
+		}}, Settings{
+			Timeout: 120, MaxConnections: 2, Refresh: RefreshPolicy{Depth: 2, OlderThan: 7 * 24 * time.Hour}, CreateSubDirectory: true,
+			Exts: []string{".mkv", ".mp4", ".iso", ".ts"}, AltExts: []string{".srt", ".ass"},
+		}},
+		{"override exts", RemoteDirectory{Path: "/music", Overrides: Overrides{Exts: []string{".flac"}}}, Settings{
+			Timeout: 30, MaxConnections: 2, ForceRefresh: true, Refresh: RefreshPolicy{Depth: 2},
+			Exts: []string{".flac"}, AltExts: []string{".srt"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.Settings(e, tt.remote); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Settings() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRemoteDirectories(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": `
+database: strm.db
+endpoints:
+  - base-url: http://alist:5244
+    dirs:
+      - local-directory: media
+        force-refresh: true
+        remote-directories:
+          - /movies
+          - path: /4k
+            timeout: 120
+            exts: [.ts]
+            exts-mode: extend
+`})
+	c, err := loadConfig(filepath.Join(dir, "config.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Endpoints[0].Dirs[0]
+	if d.ForceRefresh == nil || !*d.ForceRefresh {
+		t.Errorf("dir overrides not loaded: %+v", d.Overrides)
+	}
+	want := []RemoteDirectory{
+		{Path: "/movies"},
+		{Path: "/4k", Overrides: Overrides{Timeout: 120, Exts: []string{".ts"}, ExtsMode: ExtsModeExtend}},
+	}
+	if !reflect.DeepEqual(d.RemoteDirectories, want) {
+		t.Errorf("remote directories = %+v, want %+v", d.RemoteDirectories, want)
+	}
+}
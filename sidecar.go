@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// 额外文件的同步策略
+const (
+	AltExtPolicyOnce = "once" // 只在本地不存在时下载，随strm一起删除
+	AltExtPolicySync = "sync" // 远程文件大小或修改时间变化时重新下载，随strm一起删除
+	AltExtPolicyKeep = "keep" // 只在本地不存在时下载，永不删除
+)
+
+// altExtPolicy 获取文件对应的同步策略，未配置时使用全局策略，全局策略未配置时为sync
+func altExtPolicy(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	for k, p := range config.AltExtPolicies {
+		if normalizeExt(k) == ext {
+			return p
+		}
+	}
+	if config.AltExtPolicy != "" {
+		return config.AltExtPolicy
+	}
+	return AltExtPolicySync
+}
+
+// Sidecar 记录一个已下载的额外文件，如 .nfo、海报、字幕等
+type Sidecar struct {
+	LocalPath  string `json:"local_path"`
+	RemotePath string `json:"remote_path"`
+	Size       int64  `json:"size"`
+	Modified   string `json:"modified"`
+	HashType   string `json:"hash_type,omitempty"` // 校验下载文件使用的hash算法
+	Hash       string `json:"hash,omitempty"`      // 校验通过的hash值
+}
+
+// Key 生成Sidecar对象的唯一键
+func (s *Sidecar) Key() string {
+	return filepath.Clean(s.LocalPath)
+}
+
+// Changed 判断远程文件是否发生变化
+func (s *Sidecar) Changed(size int64, modified string) bool {
+	return s.Size != size || s.Modified != modified
+}
+
+// SameContent 根据记录的hash判断远程文件内容是否与本地一致，没有可比较的hash时返回false
+func (s *Sidecar) SameContent(hashes map[string]string) bool {
+	return s.Hash != "" && hashes[s.HashType] == s.Hash
+}
+
+// Save 保存Sidecar对象
+func (s *Sidecar) Save() error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("sidecar"))
+		if err != nil {
+			return err
+		}
+		byts, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(s.Key()), byts); err != nil {
+			return err
+		}
+		// 远程路径到本地路径的索引，用于在本地文件名变化时移动文件
+		idx, err := tx.CreateBucketIfNotExists([]byte("sidecar-remote"))
+		if err != nil {
+			return err
+		}
+		return idx.Put([]byte(s.RemotePath), []byte(s.Key()))
+	})
+}
+
+// Delete 删除本地文件及数据库记录
+func (s *Sidecar) Delete() error {
+	if err := os.Remove(s.LocalPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("sidecar"))
+		if b == nil {
+			return nil
+		}
+		if idx := tx.Bucket([]byte("sidecar-remote")); idx != nil && string(idx.Get([]byte(s.RemotePath))) == s.Key() {
+			if err := idx.Delete([]byte(s.RemotePath)); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(s.Key()))
+	})
+}
+
+// GetSidecar 根据本地路径获取Sidecar对象，不存在时返回nil
+func GetSidecar(localPath string) *Sidecar {
+	var sidecar *Sidecar
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("sidecar"))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(filepath.Clean(localPath)))
+		if v == nil {
+			return nil
+		}
+		sidecar = &Sidecar{}
+		return json.Unmarshal(v, sidecar)
+	})
+	return sidecar
+}
+
+// GetSidecarByRemotePath 根据远程路径获取最近保存的Sidecar对象，不存在时返回nil
+func GetSidecarByRemotePath(remotePath string) *Sidecar {
+	var localPath string
+	db.View(func(tx *bolt.Tx) error {
+		if idx := tx.Bucket([]byte("sidecar-remote")); idx != nil {
+			localPath = string(idx.Get([]byte(remotePath)))
+		}
+		return nil
+	})
+	if localPath == "" {
+		return nil
+	}
+	return GetSidecar(localPath)
+}
+
+// GetSidecarsInDir 获取本地目录中记录的所有Sidecar对象
+func GetSidecarsInDir(localDir string) ([]*Sidecar, error) {
+	sidecars := make([]*Sidecar, 0)
+	localDir = filepath.Clean(localDir)
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("sidecar"))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		prefix := []byte(localDir + string(filepath.Separator))
+		for k, v := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, v = c.Next() {
+			if filepath.Dir(string(k)) != localDir {
+				continue
+			}
+			s := &Sidecar{}
+			if err := json.Unmarshal(v, s); err != nil {
+				return err
+			}
+			sidecars = append(sidecars, s)
+		}
+		return nil
+	})
+	return sidecars, err
+}
+
+// hasStrmFile 判断本地目录中是否还有strm文件
+func hasStrmFile(localDir string) bool {
+	entries, err := os.ReadDir(localDir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !e.IsDir() && (isStrmFile(e.Name()) || getLinkRecord(filepath.Join(localDir, e.Name())) != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// 媒体文件对应的图片后缀，如 Movie-poster.jpg、Movie-fanart.jpg
+var artworkSuffixes = []string{"poster", "fanart", "thumb", "landscape", "banner", "clearart", "clearlogo", "logo", "disc", "discart", "backdrop", "keyart"}
+
+// isSidecarOf 判断额外文件是否属于文件名（不含扩展名）为base的媒体文件：文件名相同，如 Movie.nfo；
+// 只多了语言和标记，如 Movie.chs.forced.srt；或为图片，如 Movie-poster.jpg。Movie-part2.srt 不属于 Movie
+func isSidecarOf(name, base string) bool {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	switch {
+	case stem == base:
+		return true
+	case strings.HasPrefix(stem, base+"."):
+		return subtitleTags(name) == stem[len(base):]
+	case strings.HasPrefix(stem, base+"-"):
+		return contains(artworkSuffixes, strings.ToLower(stem[len(base)+1:]))
+	}
+	return false
+}
+
+// deleteSidecarsOf 删除属于strm的额外文件，需要在strm文件删除后调用
+//
+// 按 isSidecarOf 判断属于该strm的额外文件（如 Movie.nfo、Movie.chs.srt、Movie-poster.jpg），
+// 目录中不再有strm文件时，目录中其余的额外文件（如 poster.jpg）也一起删除。策略为keep的文件不会被删除
+func deleteSidecarsOf(s *Strm) int {
+	sidecars, err := GetSidecarsInDir(s.LocalDir)
+	if err != nil {
+		logger.Warnf("[MAIN]: get sidecars in %s error: %s", s.LocalDir, err)
+		return 0
+	}
+	base := strings.TrimSuffix(s.Name, filepath.Ext(s.Name))
+	orphan := !hasStrmFile(s.LocalDir)
+	deleted := 0
+	for _, v := range sidecars {
+		if altExtPolicy(v.LocalPath) == AltExtPolicyKeep {
+			continue
+		}
+		name := filepath.Base(v.LocalPath)
+		if !orphan && !isSidecarOf(name, base) {
+			continue
+		}
+		if err := v.Delete(); err != nil {
+			logger.Warnf("[MAIN]: delete sidecar %s failed: %s", v.LocalPath, err)
+			continue
+		}
+		deleted++
+		logger.Infof("[MAIN]: delete sidecar %s success", v.LocalPath)
+	}
+	return deleted
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestIsSidecarOf(t *testing.T) {
+	tests := []struct {
+		name string
+		base string
+		want bool
+	}{
+		{"Movie.nfo", "Movie", true},
+		{"Movie.srt", "Movie", true},
+		{"Movie.chs.srt", "Movie", true},
+		{"Movie.en.forced.srt", "Movie", true},
+		{"Movie-poster.jpg", "Movie", true},
+		{"Movie-Fanart.jpg", "Movie", true},
+		{"Movie (2010).zh-CN.ass", "Movie (2010)", true},
+		{"Movie-part2.srt", "Movie", false},
+		{"Movie-part2.nfo", "Movie", false},
+		{"Movie.part2.srt", "Movie", false},
+		{"Movie 2.srt", "Movie", false},
+		{"Movies.srt", "Movie", false},
+		{"poster.jpg", "Movie", false},
+	}
+	for _, tt := range tests {
+		if got := isSidecarOf(tt.name, tt.base); got != tt.want {
+			t.Errorf("isSidecarOf(%q, %q) = %v, want %v", tt.name, tt.base, got, tt.want)
+		}
+	}
+}
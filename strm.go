@@ -4,18 +4,23 @@ import (
 	"crypto/sha1"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
-	"path"
 
 	"github.com/boltdb/bolt"
 )
 
 type Strm struct {
-	Name      string `json:"name"`
-	LocalDir  string `json:"local_dir"`
-	RemoteDir string `json:"remote_dir"`
-	RawURL    string `json:"raw_url"`
+	Name       string            `json:"name"`
+	LocalDir   string            `json:"local_dir"`
+	RemoteDir  string            `json:"remote_dir"`
+	RawURL     string            `json:"raw_url"`
+	Size       int64             `json:"size,omitempty"`       // 远程文件大小，读取本地strm文件时为0
+	Foreign    bool              `json:"-"`                    // 本地strm文件指向的不是当前服务器
+	Format     string            `json:"format,omitempty"`     // 输出格式，为空时为strm
+	NFO        *NFO              `json:"-"`                    // nfo文件生成规则，为nil时不生成
+	SidecarNFO bool              `json:"-"`                    // 通过alt-exts同步了远程的nfo文件，不生成nfo
+	KodiProps  map[string]string `json:"-"`                    // kodi格式写入的 #KODIPROP
+	LocalPath  string            `json:"local_path,omitempty"` // 远程文件映射到本地挂载目录的路径，local、symlink、hardlink模式使用
 }
 
 // 生成Strm对象的唯一键
@@ -24,15 +29,23 @@ func (s *Strm) Key() string {
 	return fmt.Sprintf("%x", byts)
 }
 
+// target 写入文件的内容，映射到本地路径时为本地路径，否则为链接
+func (s *Strm) target() string {
+	if s.LocalPath != "" {
+		return s.LocalPath
+	}
+	return s.RawURL
+}
+
 // 将Strm对象序列化为JSON字节数组
 func (s *Strm) Value() []byte {
 	byts, _ := json.Marshal(s)
 	return byts
 }
 
-// 删除Strm对象
+// 删除Strm对象，播放列表格式只删除对应的条目
 func (s *Strm) Delete() error {
-	err := os.RemoveAll(path.Join(s.LocalDir, s.Name))
+	err := writerOf(s.Format).Remove(s)
 	if err != nil {
 		return err
 	}
@@ -56,32 +69,29 @@ func (s *Strm) Save() error {
 	})
 }
 
-// 生成Strm文件
+// 批量保存Strm对象
+func SaveStrms(strms []*Strm) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("strm"))
+		if err != nil {
+			return err
+		}
+		for _, s := range strms {
+			if err := b.Put([]byte(s.Key()), s.Value()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 按输出格式生成Strm文件
 func (s *Strm) GenStrm(overwrite bool) error {
 	err := os.MkdirAll(s.LocalDir, 0755)
 	if err != nil {
 		return err
 	}
-	_, err = os.Stat(path.Join(s.LocalDir, s.Name))
-	if !overwrite && !os.IsNotExist(err) {
-		return fmt.Errorf("file %s already exists and overwrite is false", path.Join(s.LocalDir, s.Name))
-	}
-	return os.WriteFile(path.Join(s.LocalDir, s.Name), []byte(s.RawURL), 0666)
-}
-
-// 检查Strm文件是否有效
-func (s *Strm) Check() bool {
-	logger.Infof("Checking %s", s.LocalDir+"/"+s.Name)
-	resp, err := http.Head(s.RawURL)
-	if err != nil {
-		logger.Errorf("http.Head(%s) error: %v", s.RawURL, err)
-		return false
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode == 302 || (resp.StatusCode == 200 && (resp.Header.Get("Content-Type") == "video/mp4" || resp.Header.Get("Content-Type") == "application/octet-stream")) {
-		return true
-	}
-	return false
+	return writerOf(s.Format).Write(s, overwrite)
 }
 
 // 根据rawUrl获取Strm对象
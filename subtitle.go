@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 字幕文件扩展名，字幕会被重命名为对应strm文件的文件名
+var subtitleExts = []string{".srt", ".ass", ".ssa", ".vtt", ".sub", ".idx", ".sup", ".smi"}
+
+// 字幕的语言代码，ISO 639-1 全部代码以及 ISO 639-2 中常用语言的代码
+var subtitleLanguages = toSet(strings.Fields(`
+aa ab ae af ak am an ar as av ay az ba be bg bh bi bm bn bo br bs ca ce ch co cr cs cu cv cy
+da de dv dz ee el en eo es et eu fa ff fi fj fo fr fy ga gd gl gn gu gv ha he hi ho hr ht hu
+hy hz ia id ie ig ii ik io is it iu ja jv ka kg ki kj kk kl km kn ko kr ks ku kv kw ky la lb
+lg li ln lo lt lu lv mg mh mi mk ml mn mr ms mt my na nb nd ne ng nl nn no nr nv ny oc oj om
+or os pa pi pl ps pt qu rm rn ro ru rw sa sc sd se sg si sk sl sm sn so sq sr ss st su sv sw
+ta te tg th ti tk tl tn to tr ts tt tw ty ug uk ur uz ve vi vo wa wo xh yi yo za zh zu
+eng chi zho jpn kor fre fra ger deu spa ita por rus ara hin tha vie ind msa dut nld swe nor nob
+nno dan fin pol tur gre ell heb hun cze ces rum ron ukr bul hrv srp slo slk slv lav lit est fas
+isl fil tgl cat baq eus glg ben tam tel mal kan mar urd yue cmn und
+`))
+
+// 字幕的标记以及常用的非标准中文语言标记
+var subtitleFlags = toSet([]string{"forced", "default", "sdh", "cc", "hi", "chs", "cht", "tc", "gb", "big5"})
+
+// 中文的语言名称，如 简体、繁体、中英
+var subtitleHanPattern = regexp.MustCompile(`^\p{Han}{1,4}$`)
+
+// 语言代码后的地区或文字，如 zh-CN、pt_BR、zh-Hans、es-419
+var subtitleRegionPattern = regexp.MustCompile(`(?i)^(?:[a-z]{2}|[a-z]{4}|\d{3})$`)
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// isSubtitleTag 判断字幕文件名中的一部分是否为语言或标记，如 chs、zh-CN、eng、forced、简体；
+// End、DTS 等普通单词不是语言
+func isSubtitleTag(token string) bool {
+	lower := strings.ToLower(token)
+	if subtitleFlags[lower] || subtitleHanPattern.MatchString(token) {
+		return true
+	}
+	lang, region, found := strings.Cut(strings.ReplaceAll(lower, "_", "-"), "-")
+	return subtitleLanguages[lang] && (!found || subtitleRegionPattern.MatchString(region))
+}
+
+// 最多保留的标记数量
+const maxSubtitleTags = 3
+
+// isSubtitle 判断文件是否为字幕文件
+func isSubtitle(name string) bool {
+	return checkExt(name, subtitleExts)
+}
+
+// subtitleTags 解析字幕文件名末尾的语言和标记，返回如 .chs.forced 的后缀，没有时返回空字符串
+func subtitleTags(name string) string {
+	tokens := strings.Split(strings.TrimSuffix(name, filepath.Ext(name)), ".")
+	i := len(tokens)
+	// 第一个部分总是文件名
+	for i > 1 && len(tokens)-i < maxSubtitleTags && isSubtitleTag(tokens[i-1]) {
+		i--
+	}
+	if i == len(tokens) {
+		return ""
+	}
+	return "." + strings.Join(tokens[i:], ".")
+}
+
+// subtitleName 计算字幕文件在本地的文件名，mediaBase为对应媒体文件名（不含扩展名），为空时表示字幕与媒体文件名不对应
+//
+// 字幕文件名以媒体文件名开头时保留后面的部分，如 Movie.2160p.chs.forced.ass -> Title (2010).chs.forced.ass，
+// 否则只保留末尾的语言和标记，如 Subs.eng.srt -> Title (2010).eng.srt
+func subtitleName(name, mediaBase string, s *Strm) string {
+	if s.Format == FormatM3U {
+		// 播放列表没有对应单个媒体的文件名
+		return name
+	}
+	base := strings.TrimSuffix(s.Name, filepath.Ext(s.Name))
+	if mediaBase != "" && strings.HasPrefix(name, mediaBase+".") {
+		return base + name[len(mediaBase):]
+	}
+	return base + subtitleTags(name) + strings.ToLower(filepath.Ext(name))
+}
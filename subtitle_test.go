@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestSubtitleTags(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Movie.srt", ""},
+		{"Movie.chs.srt", ".chs"},
+		{"Movie.en.forced.srt", ".en.forced"},
+		{"Movie.zh-CN.ass", ".zh-CN"},
+		{"Movie.pt_BR.srt", ".pt_BR"},
+		{"Movie.es-419.srt", ".es-419"},
+		{"Movie.zh-Hant.srt", ".zh-Hant"},
+		{"Movie.eng.sdh.srt", ".eng.sdh"},
+		{"Movie.简体.ass", ".简体"},
+		{"Movie.2160p.chs.srt", ".chs"},
+		{"The.End.srt", ""},
+		{"Movie.DTS.srt", ""},
+		{"Movie.Web.srt", ""},
+		{"Movie.en-Foo.srt", ""},
+		{"chs.srt", ""},
+		{"Movie.a.b.c.d.srt", ""},
+		{"Movie.ja.en.zh.ko.srt", ".en.zh.ko"},
+	}
+	for _, tt := range tests {
+		if got := subtitleTags(tt.name); got != tt.want {
+			t.Errorf("subtitleTags(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubtitleName(t *testing.T) {
+	s := &Strm{Name: "Title (2010).strm"}
+	tests := []struct {
+		name      string
+		mediaBase string
+		want      string
+	}{
+		{"Movie.2160p.chs.forced.ass", "Movie.2160p", "Title (2010).chs.forced.ass"},
+		{"Subs.eng.SRT", "", "Title (2010).eng.srt"},
+		{"The.End.srt", "", "Title (2010).srt"},
+	}
+	for _, tt := range tests {
+		if got := subtitleName(tt.name, tt.mediaBase, s); got != tt.want {
+			t.Errorf("subtitleName(%q, %q) = %q, want %q", tt.name, tt.mediaBase, got, tt.want)
+		}
+	}
+}
+
+func TestInLocalDir(t *testing.T) {
+	tests := []struct {
+		path string
+		root string
+		want bool
+	}{
+		{"media/movies/A.srt", "./media", true},
+		{"media/movies/A.srt", "media/", true},
+		{"/data/media/A.srt", "/data/media/", true},
+		{"/data/media2/A.srt", "/data/media", false},
+		{"/data/A.srt", "/data/media", false},
+		{"media", "./media/", true},
+	}
+	for _, tt := range tests {
+		if got := inLocalDir(tt.path, tt.root); got != tt.want {
+			t.Errorf("inLocalDir(%q, %q) = %v, want %v", tt.path, tt.root, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 配置项的默认值
+const (
+	defaultTimeout        = 30
+	defaultMaxConnections = 5
+)
+
+// ConfigProblem 配置文件中的一个问题
+type ConfigProblem struct {
+	Field   string // 出现问题的配置项，如 endpoints[0].dirs[1].local-directory
+	Message string
+	Warning bool // 警告不会阻止程序运行，通常已经使用默认值修正
+}
+
+func (p ConfigProblem) String() string {
+	return fmt.Sprintf("%s: %s", p.Field, p.Message)
+}
+
+// configErrors 统计问题中错误的数量
+func configErrors(problems []ConfigProblem) int {
+	n := 0
+	for _, p := range problems {
+		if !p.Warning {
+			n++
+		}
+	}
+	return n
+}
+
+// validator 收集检查过程中发现的问题
+type validator struct {
+	config   *Config
+	problems []ConfigProblem
+}
+
+func (v *validator) errorf(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, ConfigProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, ConfigProblem{Field: field, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+// Validate 检查配置并填充默认值，返回发现的所有问题
+func (c *Config) Validate() []ConfigProblem {
+	v := &validator{config: c}
+	if c.Database == "" {
+		v.errorf("database", "database file is required")
+	}
+	switch strings.ToLower(c.Loglevel) {
+	case "":
+		c.Loglevel = "info"
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+	default:
+		v.errorf("loglevel", "unknown log level %q, support: trace, debug, info, warn, error, fatal, panic", c.Loglevel)
+	}
+	switch {
+	case c.Timeout < 0:
+		v.errorf("timeout", "timeout must not be negative, got %d", c.Timeout)
+	case c.Timeout == 0:
+		c.Timeout = defaultTimeout
+	}
+	c.Exts = v.exts("exts", c.Exts)
+	c.AltExts = v.exts("alt-exts", c.AltExts)
+	if !validAltExtPolicy(c.AltExtPolicy) {
+		v.errorf("alt-ext-policy", "unknown policy %q, support: once, sync, keep", c.AltExtPolicy)
+	}
+	for ext, policy := range c.AltExtPolicies {
+		if policy == "" || !validAltExtPolicy(policy) {
+			v.errorf("alt-ext-policies."+ext, "unknown policy %q, support: once, sync, keep", policy)
+		}
+	}
+	if len(c.Endpoints) == 0 {
+		v.errorf("endpoints", "at least one endpoint is required")
+	}
+	for i := range c.Endpoints {
+		v.endpoint(fmt.Sprintf("endpoints[%d]", i), &c.Endpoints[i])
+	}
+	v.overlaps(c.Endpoints)
+	v.names(c.Endpoints)
+	return v.problems
+}
+
+// validAltExtPolicy 判断同步策略是否有效，空字符串表示使用默认策略
+func validAltExtPolicy(policy string) bool {
+	switch policy {
+	case "", AltExtPolicyOnce, AltExtPolicySync, AltExtPolicyKeep:
+		return true
+	}
+	return false
+}
+
+// exts 检查扩展名格式，没有以.开头或包含大写字母时给出警告并修正
+func (v *validator) exts(field string, exts []string) []string {
+	for i, ext := range exts {
+		if n := normalizeExt(ext); n != ext {
+			v.warnf(fmt.Sprintf("%s[%d]", field, i), "extension %q should be written as %q", ext, n)
+			exts[i] = n
+		}
+		if exts[i] == "" || exts[i] == "." {
+			v.errorf(fmt.Sprintf("%s[%d]", field, i), "empty extension")
+		}
+	}
+	return exts
+}
+
+func (v *validator) endpoint(field string, e *Endpoint) {
+	if e.BaseURL == "" {
+		v.errorf(field+".base-url", "base url is required")
+	} else if u, err := url.Parse(e.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.errorf(field+".base-url", "invalid base url %q, must be like https://alist.example.com", e.BaseURL)
+	}
+	if e.Token == "" && e.Username == "" {
+		v.warnf(field, "no token or username configured, access alist as guest, only files visible to the guest user are listed")
+	}
+	if e.Username != "" && e.Password == "" && e.Token == "" {
+		v.errorf(field+".password", "password is required when username is set")
+	}
+	switch {
+	case e.MaxConnections < 0:
+		v.errorf(field+".max-connections", "max connections must not be negative, got %d", e.MaxConnections)
+	case e.MaxConnections == 0:
+		v.warnf(field+".max-connections", "max connections not set, use default %d", defaultMaxConnections)
+		e.MaxConnections = defaultMaxConnections
+	}
+	if e.MaxDownloads < 0 {
+		v.errorf(field+".max-downloads", "max downloads must not be negative, got %d", e.MaxDownloads)
+	}
+	if len(e.Dirs) == 0 {
+		v.errorf(field+".dirs", "at least one dir is required")
+	}
+	for i := range e.Dirs {
+		v.dir(fmt.Sprintf("%s.dirs[%d]", field, i), &e.Dirs[i])
+	}
+}
+
+func (v *validator) dir(field string, d *Dir) {
+	if d.LocalDirectory == "" {
+		v.errorf(field+".local-directory", "local directory is required")
+	}
+	if len(d.RemoteDirectories) == 0 {
+		v.errorf(field+".remote-directories", "at least one remote directory is required")
+	}
+	v.overrides(field, &d.Overrides)
+	exts := d.resolveExts(v.config.Exts, d.Exts)
+	for i := range d.RemoteDirectories {
+		remote := &d.RemoteDirectories[i]
+		remoteField := fmt.Sprintf("%s.remote-directories[%d]", field, i)
+		if !path.IsAbs(remote.Path) {
+			v.errorf(remoteField, "remote directory %q must start with /", remote.Path)
+		}
+		v.overrides(remoteField, &remote.Overrides)
+		if len(d.MediaTypes) == 0 && len(exts) > 0 && len(remote.resolveExts(exts, remote.Exts)) == 0 {
+			v.errorf(remoteField+".exts", "no media extensions configured for remote directory %q", remote.Path)
+		}
+	}
+	if _, err := d.MediaFileTypes(); err != nil {
+		v.errorf(field+".media-types", "%s", err.Error())
+	} else if len(d.MediaTypes) == 0 && len(exts) == 0 {
+		v.errorf(field+".exts", "no media extensions configured, set exts globally or in dir")
+	}
+	if _, err := d.Filter.Compile(); err != nil {
+		v.errorf(field+".filter", "%s", err.Error())
+	}
+	if _, err := d.Naming.Compile(); err != nil {
+		v.errorf(field+".naming", "%s", err.Error())
+	}
+	if _, err := d.Organize.Compile(nil); err != nil {
+		v.errorf(field+".organize", "%s", err.Error())
+	}
+	if _, err := d.Output.Compile(); err != nil {
+		v.errorf(field+".output", "%s", err.Error())
+	}
+}
+
+// overrides 检查目录或远程目录中覆盖的设置
+func (v *validator) overrides(field string, o *Overrides) {
+	if o.Timeout < 0 {
+		v.errorf(field+".timeout", "timeout must not be negative, got %d", o.Timeout)
+	}
+	if o.MaxConnections < 0 {
+		v.errorf(field+".max-connections", "max connections must not be negative, got %d", o.MaxConnections)
+	}
+	if o.ForceRefreshDepth < 0 {
+		v.errorf(field+".force-refresh-depth", "force refresh depth must not be negative, got %d", o.ForceRefreshDepth)
+	}
+	v.duration(field+".force-refresh-older-than", o.ForceRefreshOlderThan)
+	v.duration(field+".force-refresh-modified-within", o.ForceRefreshModifiedWithin)
+	o.Exts = v.exts(field+".exts", o.Exts)
+	o.AltExts = v.exts(field+".alt-exts", o.AltExts)
+	switch o.ExtsMode {
+	case "", ExtsModeOverride, ExtsModeExtend:
+	default:
+		v.errorf(field+".exts-mode", "unknown exts mode %q, support: override, extend", o.ExtsMode)
+	}
+}
+
+// names 检查服务器名称是否重复，以及同一服务器中目录名称是否重复
+func (v *validator) names(endpoints []Endpoint) {
+	endpointNames := make(map[string]string)
+	for i, e := range endpoints {
+		field := fmt.Sprintf("endpoints[%d]", i)
+		if e.Name != "" {
+			if other, ok := endpointNames[e.Name]; ok {
+				v.errorf(field+".name", "endpoint name %q is already used by %s", e.Name, other)
+			}
+			endpointNames[e.Name] = field
+		}
+		dirNames := make(map[string]string)
+		for j, d := range e.Dirs {
+			if d.Name == "" {
+				continue
+			}
+			dirField := fmt.Sprintf("%s.dirs[%d]", field, j)
+			if other, ok := dirNames[d.Name]; ok {
+				v.errorf(dirField+".name", "dir name %q is already used by %s", d.Name, other)
+			}
+			dirNames[d.Name] = dirField
+		}
+	}
+}
+
+// duration 检查时长格式，未设置时不检查
+func (v *validator) duration(field, value string) {
+	if value == "" {
+		return
+	}
+	if d, err := parseDuration(value); err != nil || d <= 0 {
+		v.errorf(field, "invalid duration %q, must be positive like 12h or 7d", value)
+	}
+}
+
+// overlaps 检查启用的目录中本地目录是否相同或互相包含，重叠的目录在remote模式下会互相删除文件
+func (v *validator) overlaps(endpoints []Endpoint) {
+	type local struct {
+		field string
+		path  string
+	}
+	locals := make([]local, 0)
+	for i, e := range endpoints {
+		for j, d := range e.Dirs {
+			if d.Disabled || d.LocalDirectory == "" {
+				continue
+			}
+			p, err := filepath.Abs(d.LocalDirectory)
+			if err != nil {
+				p = filepath.Clean(d.LocalDirectory)
+			}
+			field := fmt.Sprintf("endpoints[%d].dirs[%d].local-directory", i, j)
+			for _, l := range locals {
+				if p == l.path || strings.HasPrefix(p, l.path+string(filepath.Separator)) || strings.HasPrefix(l.path, p+string(filepath.Separator)) {
+					v.errorf(field, "local directory %q overlaps with %s", d.LocalDirectory, l.field)
+				}
+			}
+			locals = append(locals, local{field: field, path: p})
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateEndpointLogin(t *testing.T) {
+	tests := []struct {
+		name    string
+		e       Endpoint
+		message string
+		warning bool
+	}{
+		{"guest", Endpoint{}, "access alist as guest", true},
+		{"token", Endpoint{Token: "token"}, "", false},
+		{"password", Endpoint{Username: "admin", Password: "pw"}, "", false},
+		{"missing password", Endpoint{Username: "admin"}, "password is required", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.e.BaseURL = "http://alist:5244"
+			tt.e.MaxConnections = 1
+			tt.e.Dirs = []Dir{{LocalDirectory: "media", RemoteDirectories: []RemoteDirectory{{Path: "/movies"}}}}
+			v := &validator{config: &Config{}}
+			v.endpoint("endpoints[0]", &tt.e)
+			var found *ConfigProblem
+			for i, p := range v.problems {
+				if strings.Contains(p.Message, "guest") || strings.Contains(p.Message, "password") {
+					found = &v.problems[i]
+				}
+			}
+			if tt.message == "" {
+				if found != nil {
+					t.Errorf("endpoint() problem = %s, want none", found)
+				}
+				return
+			}
+			if found == nil || !strings.Contains(found.Message, tt.message) || found.Warning != tt.warning {
+				t.Errorf("endpoint() problem = %v, want %q (warning %v)", found, tt.message, tt.warning)
+			}
+		})
+	}
+}